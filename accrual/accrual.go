@@ -0,0 +1,160 @@
+package accrual
+
+import (
+	"log"
+	"math/big"
+	"time"
+
+	"go-ubipay-websocket/config"
+	"go-ubipay-websocket/database"
+	"go-ubipay-websocket/models"
+	"go-ubipay-websocket/points"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Accruer converts connected time into point credits. It is shared by the
+// accrual cron and the disconnect settlement so both go through the same
+// ledger path.
+type Accruer struct {
+	cfg       *config.Config
+	db        database.Store
+	rates     rateTable
+	campaigns campaignCache
+}
+
+// Tier is what a user's accrual multiplier depends on: the rate of its
+// user type / VIP level and the VIP level campaigns target
+type Tier struct {
+	Rate    points.Points
+	UserVip int
+}
+
+// Result describes a single accrual attempt
+type Result struct {
+	Points points.Points
+	// Carry is the part of a point below points.Scale precision that has
+	// been earned but not yet credited, nil when there is none
+	Carry *big.Rat
+	// Exhausted lists the accrual caps this credit used up
+	Exhausted []database.CapUsage
+	// Referrals are the referral bonuses paid out of this credit
+	Referrals []*models.TransactionMovement
+	// Boost is the campaign multiplier applied on top of the tier rate, 0
+	// when no campaign was running
+	Boost      points.Points
+	CampaignID primitive.ObjectID
+}
+
+func NewAccruer(cfg *config.Config, db database.Store) *Accruer {
+	return &Accruer{
+		cfg: cfg,
+		db:  db,
+	}
+}
+
+// Prorate returns the points earned for elapsed connected time at the given
+// multiplier, exact to points.Scale decimals, plus the exact remainder to
+// carry into the next window. carry is not modified.
+func (a *Accruer) Prorate(elapsed time.Duration, carry, multiplier *big.Rat) (points.Points, *big.Rat) {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	earned := new(big.Rat).Mul(a.cfg.AccrualPoints.Rat(), big.NewRat(int64(elapsed), int64(a.cfg.AccrualPeriod)))
+	earned.Mul(earned, multiplier)
+	if carry != nil {
+		earned.Add(earned, carry)
+	}
+
+	credited := points.Truncate(earned)
+	rest := earned.Sub(earned, credited.Rat())
+	if rest.Sign() == 0 {
+		return credited, nil
+	}
+	return credited, rest
+}
+
+// Caps returns the configured accrual caps
+func (a *Accruer) Caps() database.AccrualCaps {
+	return database.AccrualCaps{
+		Daily:    a.cfg.AccrualDailyCap,
+		Weekly:   a.cfg.AccrualWeeklyCap,
+		Lifetime: a.cfg.AccrualLifetimeCap,
+	}
+}
+
+// Allowance returns the user's remaining accrual allowance, nil when no cap
+// is configured
+func (a *Accruer) Allowance(userID primitive.ObjectID) (*database.Allowance, error) {
+	caps := a.Caps()
+	if !caps.Enabled() {
+		return nil, nil
+	}
+	return a.db.AccrualAllowance(userID, caps)
+}
+
+// multiplier returns the tier rate times the campaign boost for the window
+func (a *Accruer) multiplier(userID primitive.ObjectID, from, to time.Time, tier Tier) (*big.Rat, points.Points, primitive.ObjectID) {
+	boost, campaignID := a.boost(userID, tier.UserVip, from, to)
+	multiplier := new(big.Rat).Mul(tier.Rate.Rat(), boost)
+	if campaignID.IsZero() {
+		return multiplier, 0, campaignID
+	}
+	return multiplier, points.Truncate(boost), campaignID
+}
+
+// Accrue credits the points earned between from and to. The window start is
+// the idempotency key, so crediting the same window twice returns
+// database.ErrDuplicateTransaction without touching the balance. Time earned
+// beyond an accrual cap is forfeited, not carried into the next window.
+// Referral bonuses are paid out of the credited amount in the same write.
+func (a *Accruer) Accrue(userID primitive.ObjectID, username string, from, to time.Time, carry *big.Rat, tier Tier) (Result, error) {
+	multiplier, boost, campaignID := a.multiplier(userID, from, to, tier)
+	earned, carry := a.Prorate(to.Sub(from), carry, multiplier)
+	if earned <= 0 {
+		return Result{Carry: carry}, nil
+	}
+
+	key := database.AccrualKey(userID, from)
+	outcome, err := a.db.AccruePoints(database.Movement{
+		UserID:         userID,
+		Username:       username,
+		Amount:         earned,
+		IdempotencyKey: key,
+		Rate:           tier.Rate,
+		Boost:          boost,
+		CampaignID:     campaignID,
+	}, a.Caps(), a.referralChain(userID, username))
+	if err == database.ErrCapReached {
+		return Result{}, nil
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	if outcome.Credited < earned {
+		carry = nil
+	}
+	for _, bonus := range outcome.Referrals {
+		log.Printf("🤝 Referral bonus of %s points to %s (level %d) from %s", bonus.Amount, bonus.Username, bonus.ReferralLevel, username)
+	}
+	return Result{
+		Points:     outcome.Credited,
+		Carry:      carry,
+		Exhausted:  outcome.Exhausted,
+		Referrals:  outcome.Referrals,
+		Boost:      boost,
+		CampaignID: campaignID,
+	}, nil
+}
+
+// Settle credits the final partial window of a closed session. Amounts below
+// cfg.MinSettlementPoints are dropped to avoid dust transactions.
+func (a *Accruer) Settle(userID primitive.ObjectID, username string, from, to time.Time, carry *big.Rat, tier Tier) (Result, error) {
+	multiplier, _, _ := a.multiplier(userID, from, to, tier)
+	earned, _ := a.Prorate(to.Sub(from), carry, multiplier)
+	if earned < a.cfg.MinSettlementPoints {
+		return Result{}, nil
+	}
+	return a.Accrue(userID, username, from, to, carry, tier)
+}
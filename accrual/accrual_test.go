@@ -0,0 +1,68 @@
+package accrual
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"go-ubipay-websocket/config"
+	"go-ubipay-websocket/database"
+	"go-ubipay-websocket/points"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTestAccruer(cfg *config.Config) (*Accruer, *database.MemoryStore) {
+	db := database.NewTestDatabase()
+	return NewAccruer(cfg, db), db
+}
+
+func TestProrateKeepsCarryExact(t *testing.T) {
+	a, _ := newTestAccruer(&config.Config{AccrualPoints: points.One, AccrualPeriod: 3 * time.Minute})
+
+	// A third of a point per minute: 0.3333 + 0.3333 + 0.3334
+	var total points.Points
+	var carry *big.Rat
+	for i := 0; i < 3; i++ {
+		var earned points.Points
+		earned, carry = a.Prorate(time.Minute, carry, big.NewRat(1, 1))
+		total += earned
+	}
+	if total != points.One || carry != nil {
+		t.Errorf("three thirds credited %s with carry %v, want 1 and none", total, carry)
+	}
+
+	// A carry passed in is left untouched
+	in := big.NewRat(1, 30000)
+	earned, out := a.Prorate(0, in, big.NewRat(1, 1))
+	if earned != 0 || out.Cmp(big.NewRat(1, 30000)) != 0 || in.Cmp(big.NewRat(1, 30000)) != 0 {
+		t.Errorf("Prorate(0, 1/30000) = %s, %v; carry in became %v", earned, out, in)
+	}
+}
+
+func TestSettleCreditsPartialWindowAtDefaults(t *testing.T) {
+	for _, key := range []string{"ACCRUAL_POINTS", "POINTS_PER_MINUTE", "ACCRUAL_PERIOD", "MIN_SETTLEMENT_POINTS",
+		"ACCRUAL_DAILY_CAP", "ACCRUAL_WEEKLY_CAP", "ACCRUAL_LIFETIME_CAP", "REFERRAL_PERCENTAGES"} {
+		t.Setenv(key, "")
+	}
+	a, db := newTestAccruer(config.LoadConfig())
+	userID := primitive.NewObjectID()
+
+	// 59s of a 1 point per minute window
+	to := time.Now()
+	result, err := a.Settle(userID, "alice", to.Add(-59*time.Second), to, nil, Tier{Rate: points.One})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := points.Points(9833); result.Points != want {
+		t.Errorf("settled %s points, want %s", result.Points, want)
+	}
+
+	wallet, err := db.GetUserWallet(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance, _ := database.BalanceOf(wallet); balance != result.Points {
+		t.Errorf("balance = %s, want %s", balance, result.Points)
+	}
+}
@@ -0,0 +1,149 @@
+package accrual
+
+import (
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"go-ubipay-websocket/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// campaignLookback is how long ended campaigns stay cached, so a window that
+// started before a campaign ended is still boosted for its share
+const campaignLookback = 24 * time.Hour
+
+// campaignCache holds the campaigns the accrual path applies. It is swapped
+// as a whole on reload.
+type campaignCache struct {
+	mu        sync.RWMutex
+	campaigns []models.Campaign
+}
+
+// LoadCampaigns (re)loads the recent and upcoming campaigns. On error the
+// previous set is kept.
+func (a *Accruer) LoadCampaigns() error {
+	campaigns, err := a.db.ListCampaigns(time.Now().Add(-campaignLookback))
+	if err != nil {
+		return err
+	}
+
+	a.campaigns.mu.Lock()
+	a.campaigns.campaigns = campaigns
+	a.campaigns.mu.Unlock()
+	return nil
+}
+
+// Campaigns returns the cached campaigns
+func (a *Accruer) Campaigns() []models.Campaign {
+	a.campaigns.mu.RLock()
+	defer a.campaigns.mu.RUnlock()
+	return append([]models.Campaign(nil), a.campaigns.campaigns...)
+}
+
+// ActiveCampaigns returns the enabled campaigns running at the given time
+func (a *Accruer) ActiveCampaigns(at time.Time) []models.Campaign {
+	a.campaigns.mu.RLock()
+	defer a.campaigns.mu.RUnlock()
+
+	active := make([]models.Campaign, 0)
+	for _, c := range a.campaigns.campaigns {
+		if Running(c, at) {
+			active = append(active, c)
+		}
+	}
+	return active
+}
+
+// Running reports whether the campaign is enabled and running at the given time
+func Running(c models.Campaign, at time.Time) bool {
+	return c.Enable && !at.Before(c.StartAt) && at.Before(c.EndAt)
+}
+
+// Targets reports whether the campaign applies to the user. A campaign
+// without UserVips or UserIDs applies to everyone; otherwise matching either
+// list is enough.
+func Targets(c models.Campaign, userID primitive.ObjectID, userVip int) bool {
+	if len(c.UserVips) == 0 && len(c.UserIDs) == 0 {
+		return true
+	}
+	for _, vip := range c.UserVips {
+		if vip == userVip {
+			return true
+		}
+	}
+	for _, id := range c.UserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// boost returns the campaign multiplier for the window from-to, averaged
+// over time, and the campaign that boosted the largest part of it.
+// Overlapping campaigns do not stack: the highest multiplier applies.
+func (a *Accruer) boost(userID primitive.ObjectID, userVip int, from, to time.Time) (*big.Rat, primitive.ObjectID) {
+	one := big.NewRat(1, 1)
+	if !to.After(from) {
+		return one, primitive.NilObjectID
+	}
+
+	a.campaigns.mu.RLock()
+	var matching []models.Campaign
+	for _, c := range a.campaigns.campaigns {
+		if c.Enable && c.StartAt.Before(to) && c.EndAt.After(from) && Targets(c, userID, userVip) {
+			matching = append(matching, c)
+		}
+	}
+	a.campaigns.mu.RUnlock()
+	if len(matching) == 0 {
+		return one, primitive.NilObjectID
+	}
+
+	// Split the window wherever a campaign starts or ends
+	bounds := []time.Time{from, to}
+	for _, c := range matching {
+		if c.StartAt.After(from) {
+			bounds = append(bounds, c.StartAt)
+		}
+		if c.EndAt.Before(to) {
+			bounds = append(bounds, c.EndAt)
+		}
+	}
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i].Before(bounds[j]) })
+
+	weighted := new(big.Rat)
+	boosted := make(map[primitive.ObjectID]time.Duration)
+	for i := 0; i+1 < len(bounds); i++ {
+		span := bounds[i+1].Sub(bounds[i])
+		if span <= 0 {
+			continue
+		}
+
+		multiplier := one
+		var best *models.Campaign
+		for k := range matching {
+			c := &matching[k]
+			if Running(*c, bounds[i]) && (best == nil || c.Multiplier > best.Multiplier) {
+				best = c
+			}
+		}
+		if best != nil {
+			multiplier = best.Multiplier.Rat()
+			boosted[best.ID] += span
+		}
+		weighted.Add(weighted, new(big.Rat).Mul(multiplier, big.NewRat(int64(span), 1)))
+	}
+
+	var campaignID primitive.ObjectID
+	var longest time.Duration
+	for _, c := range matching {
+		if boosted[c.ID] > longest {
+			campaignID, longest = c.ID, boosted[c.ID]
+		}
+	}
+	return weighted.Quo(weighted, big.NewRat(int64(to.Sub(from)), 1)), campaignID
+}
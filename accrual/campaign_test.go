@@ -0,0 +1,54 @@
+package accrual
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"go-ubipay-websocket/config"
+	"go-ubipay-websocket/models"
+	"go-ubipay-websocket/points"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBoostAveragesOverWindow(t *testing.T) {
+	a, db := newTestAccruer(&config.Config{})
+	userID := primitive.NewObjectID()
+	from := time.Now().Truncate(time.Minute)
+	to := from.Add(10 * time.Minute)
+
+	double := models.Campaign{Name: "double", Multiplier: points.FromInt(2), StartAt: from.Add(5 * time.Minute), EndAt: to.Add(time.Hour), Enable: true}
+	triple := models.Campaign{Name: "triple", Multiplier: points.FromInt(3), StartAt: from.Add(8 * time.Minute), EndAt: from.Add(9 * time.Minute), Enable: true}
+	vipOnly := models.Campaign{Name: "vip", Multiplier: points.FromInt(10), StartAt: from, EndAt: to, UserVips: []int{5}, Enable: true}
+	disabled := models.Campaign{Name: "disabled", Multiplier: points.FromInt(10), StartAt: from, EndAt: to}
+	for _, c := range []*models.Campaign{&double, &triple, &vipOnly, &disabled} {
+		if err := db.InsertCampaign(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.LoadCampaigns(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 5m at 1x, 3m at 2x, 1m at 3x (highest wins), 1m at 2x
+	boost, campaignID := a.boost(userID, 0, from, to)
+	if want := big.NewRat(5+6+3+2, 10); boost.Cmp(want) != 0 {
+		t.Errorf("boost = %s, want %s", boost.RatString(), want.RatString())
+	}
+	if campaignID != double.ID {
+		t.Errorf("campaign = %s, want the one that boosted longest (%s)", campaignID.Hex(), double.ID.Hex())
+	}
+
+	// The VIP campaign applies to level 5 over the whole window
+	if boost, campaignID := a.boost(userID, 5, from, to); boost.Cmp(big.NewRat(10, 1)) != 0 || campaignID != vipOnly.ID {
+		t.Errorf("vip boost = %s from %s", boost.RatString(), campaignID.Hex())
+	}
+
+	if boost, campaignID := a.boost(userID, 0, from.Add(-time.Hour), from); boost.Cmp(big.NewRat(1, 1)) != 0 || !campaignID.IsZero() {
+		t.Errorf("boost before any campaign = %s from %s", boost.RatString(), campaignID.Hex())
+	}
+	if boost, _ := a.boost(userID, 0, to, to); boost.Cmp(big.NewRat(1, 1)) != 0 {
+		t.Errorf("boost of an empty window = %s", boost.RatString())
+	}
+}
@@ -0,0 +1,86 @@
+package accrual
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"go-ubipay-websocket/models"
+	"go-ubipay-websocket/points"
+)
+
+// rateTable maps user tiers to accrual multipliers. It is loaded from
+// cfg.AccrualRatesFile or the TblAccrualRate collection and swapped as a
+// whole on reload.
+type rateTable struct {
+	mu    sync.RWMutex
+	rates []models.AccrualRate
+}
+
+// LoadRates (re)loads the rate table and returns the number of rates. On
+// error the previous table is kept.
+func (a *Accruer) LoadRates() (int, error) {
+	var rates []models.AccrualRate
+	if a.cfg.AccrualRatesFile != "" {
+		data, err := os.ReadFile(a.cfg.AccrualRatesFile)
+		if err != nil {
+			return 0, err
+		}
+		if err := json.Unmarshal(data, &rates); err != nil {
+			return 0, fmt.Errorf("%s: %w", a.cfg.AccrualRatesFile, err)
+		}
+	} else {
+		var err error
+		if rates, err = a.db.ListAccrualRates(); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, rate := range rates {
+		if rate.Multiplier < 0 {
+			return 0, fmt.Errorf("negative accrual multiplier %s", rate.Multiplier)
+		}
+	}
+
+	a.rates.mu.Lock()
+	a.rates.rates = rates
+	a.rates.mu.Unlock()
+	return len(rates), nil
+}
+
+// Rates returns the loaded rate table
+func (a *Accruer) Rates() []models.AccrualRate {
+	a.rates.mu.RLock()
+	defer a.rates.mu.RUnlock()
+	return append([]models.AccrualRate(nil), a.rates.rates...)
+}
+
+// Rate returns the multiplier for a tier. The most specific rate wins: one
+// matching both user type and VIP level, then VIP level only, then user type
+// only. Tiers without a rate earn at 1x.
+func (a *Accruer) Rate(userType, userVip int) points.Points {
+	a.rates.mu.RLock()
+	defer a.rates.mu.RUnlock()
+
+	rate, best := points.One, 0
+	for _, r := range a.rates.rates {
+		if r.UserType != nil && *r.UserType != userType || r.UserVip != nil && *r.UserVip != userVip {
+			continue
+		}
+
+		score := 1
+		switch {
+		case r.UserType != nil && r.UserVip != nil:
+			score = 4
+		case r.UserVip != nil:
+			score = 3
+		case r.UserType != nil:
+			score = 2
+		}
+		if score > best {
+			rate, best = r.Multiplier, score
+		}
+	}
+	return rate
+}
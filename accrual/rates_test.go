@@ -0,0 +1,44 @@
+package accrual
+
+import (
+	"testing"
+
+	"go-ubipay-websocket/config"
+	"go-ubipay-websocket/models"
+	"go-ubipay-websocket/points"
+)
+
+func TestRateSpecificity(t *testing.T) {
+	a, db := newTestAccruer(&config.Config{})
+	ptr := func(n int) *int { return &n }
+	db.SetAccrualRates([]models.AccrualRate{
+		{Multiplier: points.FromInt(2)},
+		{UserType: ptr(1), Multiplier: points.FromInt(3)},
+		{UserVip: ptr(2), Multiplier: points.FromInt(4)},
+		{UserType: ptr(1), UserVip: ptr(2), Multiplier: points.FromInt(5)},
+	})
+	if _, err := a.LoadRates(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		userType, userVip int
+		want              points.Points
+	}{
+		{0, 0, points.FromInt(2)},
+		{1, 0, points.FromInt(3)},
+		{0, 2, points.FromInt(4)},
+		{1, 2, points.FromInt(5)},
+		{3, 3, points.FromInt(2)},
+	}
+	for _, tt := range tests {
+		if got := a.Rate(tt.userType, tt.userVip); got != tt.want {
+			t.Errorf("Rate(%d, %d) = %s, want %s", tt.userType, tt.userVip, got, tt.want)
+		}
+	}
+
+	empty, _ := newTestAccruer(&config.Config{})
+	if got := empty.Rate(1, 2); got != points.One {
+		t.Errorf("Rate without a table = %s, want 1", got)
+	}
+}
@@ -0,0 +1,76 @@
+package accrual
+
+import (
+	"log"
+	"strings"
+
+	"go-ubipay-websocket/database"
+	"go-ubipay-websocket/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// referralChain returns the referrers of userID and their share of its
+// accruals. User.ReferCode names the referrer by _id (hex) or Username; the
+// chain is followed up to len(cfg.ReferralPercentages) levels and stops at a
+// self-referral, a cycle or a code that matches nobody. Disabled referrers
+// earn nothing but the chain continues past them.
+func (a *Accruer) referralChain(userID primitive.ObjectID, username string) []database.ReferralShare {
+	percentages := a.cfg.ReferralPercentages
+	if len(percentages) == 0 {
+		return nil
+	}
+
+	user, err := a.db.GetUserByID(userID)
+	if err != nil {
+		if err != database.ErrUserNotFound {
+			log.Printf("⚠️ Could not look up referrer of user %s: %v", username, err)
+		}
+		return nil
+	}
+
+	var shares []database.ReferralShare
+	visited := map[primitive.ObjectID]bool{user.ID: true}
+	for level := 1; level <= len(percentages); level++ {
+		if strings.TrimSpace(user.ReferCode) == "" {
+			break
+		}
+		referrer, err := a.resolveReferrer(user.ReferCode)
+		if err != nil {
+			log.Printf("⚠️ Referral code %q of user %s not resolved: %v", user.ReferCode, user.Username, err)
+			break
+		}
+		if referrer.ID == user.ID {
+			log.Printf("⛔ User %s has a self-referral code, referral chain ignored", user.Username)
+			break
+		}
+		if visited[referrer.ID] {
+			log.Printf("⛔ Referral cycle at user %s, stopping at level %d", referrer.Username, level)
+			break
+		}
+		visited[referrer.ID] = true
+
+		if referrer.Enable && percentages[level-1] > 0 {
+			shares = append(shares, database.ReferralShare{
+				UserID:   referrer.ID,
+				Username: referrer.Username,
+				Level:    level,
+				Percent:  percentages[level-1],
+			})
+		}
+		user = referrer
+	}
+	return shares
+}
+
+// resolveReferrer finds the user a ReferCode points to
+func (a *Accruer) resolveReferrer(code string) (*models.User, error) {
+	code = strings.TrimSpace(code)
+	if id, err := primitive.ObjectIDFromHex(code); err == nil {
+		user, err := a.db.GetUserByID(id)
+		if err != database.ErrUserNotFound {
+			return user, err
+		}
+	}
+	return a.db.GetUserByUsername(code)
+}
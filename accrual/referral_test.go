@@ -0,0 +1,45 @@
+package accrual
+
+import (
+	"testing"
+
+	"go-ubipay-websocket/config"
+	"go-ubipay-websocket/models"
+	"go-ubipay-websocket/points"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReferralChain(t *testing.T) {
+	a, db := newTestAccruer(&config.Config{
+		ReferralPercentages: []points.Points{points.FromInt(10), points.FromInt(5), points.FromInt(1)},
+	})
+
+	// carol -> bob -> alice -> carol is a cycle
+	alice := &models.User{ID: primitive.NewObjectID(), Username: "alice", Enable: true}
+	bob := &models.User{ID: primitive.NewObjectID(), Username: "bob", Enable: true, ReferCode: "alice"}
+	carol := &models.User{ID: primitive.NewObjectID(), Username: "carol", Enable: true, ReferCode: bob.ID.Hex()}
+	alice.ReferCode = "carol"
+	self := &models.User{ID: primitive.NewObjectID(), Username: "self", Enable: true, ReferCode: "self"}
+	for _, u := range []*models.User{alice, bob, carol, self} {
+		db.AddUser(u)
+	}
+
+	chain := a.referralChain(carol.ID, carol.Username)
+	if len(chain) != 2 {
+		t.Fatalf("chain = %+v, want bob and alice", chain)
+	}
+	if chain[0].UserID != bob.ID || chain[0].Level != 1 || chain[0].Percent != points.FromInt(10) {
+		t.Errorf("level 1 = %+v, want bob at 10%%", chain[0])
+	}
+	if chain[1].UserID != alice.ID || chain[1].Level != 2 || chain[1].Percent != points.FromInt(5) {
+		t.Errorf("level 2 = %+v, want alice at 5%%", chain[1])
+	}
+
+	if chain := a.referralChain(self.ID, self.Username); len(chain) != 0 {
+		t.Errorf("self-referral chain = %+v, want none", chain)
+	}
+	if chain := a.referralChain(primitive.NewObjectID(), "ghost"); len(chain) != 0 {
+		t.Errorf("unknown user chain = %+v, want none", chain)
+	}
+}
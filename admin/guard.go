@@ -0,0 +1,225 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"go-ubipay-websocket/auth"
+	"go-ubipay-websocket/config"
+	"go-ubipay-websocket/database"
+	"go-ubipay-websocket/models"
+)
+
+// Admin roles; an operator can do everything a read-only admin can
+const (
+	RoleReadOnly = "read-only"
+	RoleOperator = "operator"
+)
+
+var roleRank = map[string]int{
+	RoleReadOnly: 1,
+	RoleOperator: 2,
+}
+
+// Principal is the authenticated caller of an admin route
+type Principal struct {
+	Name   string
+	Method string
+	Role   string
+}
+
+// Authentication methods recorded in the audit log
+const (
+	MethodAPIKey = "api-key"
+	MethodJWT    = "jwt"
+)
+
+// APIKeyHeader carries a static admin API key
+const APIKeyHeader = "X-Admin-Key"
+
+// exampleAPIKey is the key older example configs and docs shipped with. It
+// is public, so it is never accepted as an admin key.
+const exampleAPIKey = "dev-admin-key"
+
+const localPrincipal = "adminPrincipal"
+
+type apiKey struct {
+	name string
+	key  []byte
+	role string
+}
+
+// Guard authenticates admin requests with a static API key or a user token
+// whose UserType maps to an admin role, and audits every call
+type Guard struct {
+	keys          []apiKey
+	userTypeRoles map[int]string
+	authenticator auth.Authenticator
+	db            database.Store
+}
+
+// NewGuard parses cfg.AdminAPIKeys ("name:key:role,...") and
+// cfg.AdminUserTypes ("userType:role,...")
+func NewGuard(cfg *config.Config, authenticator auth.Authenticator, db database.Store) (*Guard, error) {
+	g := &Guard{
+		userTypeRoles: make(map[int]string),
+		authenticator: authenticator,
+		db:            db,
+	}
+
+	for _, entry := range splitList(cfg.AdminAPIKeys) {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("ADMIN_API_KEYS entry %q must be name:key:role", entry)
+		}
+		if _, ok := roleRank[parts[2]]; !ok {
+			return nil, fmt.Errorf("ADMIN_API_KEYS entry %q: unknown role %q", parts[0], parts[2])
+		}
+		if parts[1] == exampleAPIKey {
+			return nil, fmt.Errorf("ADMIN_API_KEYS entry %q uses the example key %q, set a random key (e.g. openssl rand -hex 24)", parts[0], exampleAPIKey)
+		}
+		g.keys = append(g.keys, apiKey{name: parts[0], key: []byte(parts[1]), role: parts[2]})
+	}
+
+	for _, entry := range splitList(cfg.AdminUserTypes) {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("ADMIN_USER_TYPES entry %q must be userType:role", entry)
+		}
+		userType, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("ADMIN_USER_TYPES entry %q: %w", entry, err)
+		}
+		if _, ok := roleRank[parts[1]]; !ok {
+			return nil, fmt.Errorf("ADMIN_USER_TYPES entry %q: unknown role %q", entry, parts[1])
+		}
+		g.userTypeRoles[userType] = parts[1]
+	}
+
+	if len(g.keys) == 0 && len(g.userTypeRoles) == 0 {
+		log.Println("⚠️ No ADMIN_API_KEYS or ADMIN_USER_TYPES configured, admin API is locked")
+	} else {
+		log.Printf("🔐 Admin API: %d API keys, %d admin user types", len(g.keys), len(g.userTypeRoles))
+	}
+	return g, nil
+}
+
+func splitList(value string) []string {
+	entries := make([]string, 0)
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Authenticate is the middleware for the admin route group. It resolves the
+// caller, and writes an audit entry once the route has run, including for
+// rejected calls.
+func (g *Guard) Authenticate(c *fiber.Ctx) error {
+	start := time.Now()
+
+	principal, err := g.principal(c)
+	if err != nil {
+		g.audit(c, nil, fiber.StatusUnauthorized, start)
+		return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+	}
+	c.Locals(localPrincipal, principal)
+
+	err = c.Next()
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = fiber.StatusInternalServerError
+		if fiberErr, ok := err.(*fiber.Error); ok {
+			status = fiberErr.Code
+		}
+	}
+	g.audit(c, principal, status, start)
+	return err
+}
+
+// Require rejects callers whose role is below role with 403
+func Require(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal := CurrentPrincipal(c)
+		if principal == nil || roleRank[principal.Role] < roleRank[role] {
+			return fiber.NewError(fiber.StatusForbidden, "Requires "+role+" role")
+		}
+		return c.Next()
+	}
+}
+
+// CurrentPrincipal returns the admin set by Authenticate
+func CurrentPrincipal(c *fiber.Ctx) *Principal {
+	principal, _ := c.Locals(localPrincipal).(*Principal)
+	return principal
+}
+
+func (g *Guard) principal(c *fiber.Ctx) (*Principal, error) {
+	if key := c.Get(APIKeyHeader); key != "" {
+		for _, entry := range g.keys {
+			if subtle.ConstantTimeCompare([]byte(key), entry.key) == 1 {
+				return &Principal{Name: entry.name, Method: MethodAPIKey, Role: entry.role}, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid admin API key")
+	}
+
+	header := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, fmt.Errorf("admin credentials required")
+	}
+	if len(g.userTypeRoles) == 0 {
+		return nil, fmt.Errorf("token authentication is disabled for the admin API")
+	}
+
+	identity, err := g.authenticator.Authenticate(strings.TrimPrefix(header, "Bearer "))
+	if err != nil {
+		return nil, err
+	}
+	user, err := g.db.GetUserByID(identity.UserID)
+	if err != nil {
+		if err == database.ErrUserNotFound {
+			return nil, fmt.Errorf("unknown user")
+		}
+		return nil, err
+	}
+	if !user.Enable {
+		return nil, auth.ErrUserDisabled
+	}
+
+	role, ok := g.userTypeRoles[user.UserType]
+	if !ok {
+		return nil, fmt.Errorf("user %s is not an admin", user.Username)
+	}
+	return &Principal{Name: user.Username, Method: MethodJWT, Role: role}, nil
+}
+
+func (g *Guard) audit(c *fiber.Ctx, principal *Principal, status int, start time.Time) {
+	entry := &models.AdminAuditLog{
+		HTTPMethod: c.Method(),
+		Path:       c.Path(),
+		Query:      string(c.Request().URI().QueryString()),
+		Status:     status,
+		RemoteIP:   c.IP(),
+		DurationMs: time.Since(start).Milliseconds(),
+		CreateDate: time.Now(),
+	}
+	if principal != nil {
+		entry.Actor = principal.Name
+		entry.AuthMethod = principal.Method
+		entry.Role = principal.Role
+	}
+
+	if err := g.db.InsertAdminAudit(entry); err != nil {
+		log.Printf("❌ Failed to write admin audit entry for %s %s: %v", entry.HTTPMethod, entry.Path, err)
+	}
+}
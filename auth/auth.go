@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"go-ubipay-websocket/config"
+	"go-ubipay-websocket/database"
+	"go-ubipay-websocket/models"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+	ErrUserDisabled = errors.New("user account is disabled")
+)
+
+// Authenticator resolves a bearer token to the identity it represents
+type Authenticator interface {
+	Authenticate(token string) (*models.AuthToken, error)
+}
+
+// Chain tries each authenticator in order and returns the first identity
+// that validates. If none does, the most specific error wins over the
+// generic ErrInvalidToken (a JWT that expired is not "invalid" to the session
+// token lookup, it is just not one of its tokens).
+type Chain []Authenticator
+
+func (c Chain) Authenticate(token string) (*models.AuthToken, error) {
+	err := ErrInvalidToken
+	for _, authenticator := range c {
+		identity, authErr := authenticator.Authenticate(token)
+		if authErr == nil {
+			return identity, nil
+		}
+		if err == ErrInvalidToken {
+			err = authErr
+		}
+	}
+	return nil, err
+}
+
+// Authentication methods accepted in AUTH_METHODS
+const (
+	MethodJWT          = "jwt"
+	MethodSessionToken = "session"
+)
+
+// NewFromConfig builds the authenticator chain listed in cfg.AuthMethods
+func NewFromConfig(cfg *config.Config, users database.UserStore) (Authenticator, error) {
+	var chain Chain
+	for _, method := range strings.Split(cfg.AuthMethods, ",") {
+		switch strings.TrimSpace(method) {
+		case MethodJWT:
+			authenticator, err := NewJWTAuthenticator(cfg)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, authenticator)
+		case MethodSessionToken:
+			chain = append(chain, NewSessionTokenAuthenticator(users))
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown auth method %q", method)
+		}
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("AUTH_METHODS must list at least one of %s, %s", MethodJWT, MethodSessionToken)
+	}
+	log.Printf("🔐 Authentication methods: %s", cfg.AuthMethods)
+	return chain, nil
+}
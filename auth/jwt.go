@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go-ubipay-websocket/config"
+	"go-ubipay-websocket/models"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Claims are the JWT claims mapped onto models.AuthToken. The user ID is
+// taken from "user_id" or, if absent, the standard "sub" claim.
+type Claims struct {
+	UserID   string `json:"user_id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Email    string `json:"email,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// JWTAuthenticator verifies signed JWTs: HS256 with JWT_SECRET, and RS256 or
+// ES256 with the public keys from JWT_JWKS_FILE
+type JWTAuthenticator struct {
+	secret   []byte
+	keys     map[string]interface{}
+	issuer   string
+	audience string
+	methods  []string
+}
+
+// placeholderSecrets are the example JWT_SECRET values from the docs and
+// earlier defaults. They are public, so HS256 is never enabled with them.
+var placeholderSecrets = map[string]bool{
+	"your-secret-key-change-in-production":                true,
+	"your-super-secret-key-change-in-production":          true,
+	"your-super-secret-jwt-key-change-this-in-production": true,
+}
+
+func NewJWTAuthenticator(cfg *config.Config) (*JWTAuthenticator, error) {
+	a := &JWTAuthenticator{
+		issuer:   cfg.JWTIssuer,
+		audience: cfg.JWTAudience,
+	}
+
+	if placeholderSecrets[cfg.JWTSecret] {
+		return nil, errors.New("JWT_SECRET is an example value, set a random secret (e.g. openssl rand -hex 32)")
+	}
+	if cfg.JWTSecret != "" {
+		a.secret = []byte(cfg.JWTSecret)
+		a.methods = append(a.methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	if cfg.JWTJWKSFile != "" {
+		keys, err := loadJWKS(cfg.JWTJWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("load JWKS %s: %w", cfg.JWTJWKSFile, err)
+		}
+		a.keys = keys
+		a.methods = append(a.methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg())
+		log.Printf("🔑 Loaded %d JWKS keys from %s", len(keys), cfg.JWTJWKSFile)
+	}
+
+	if len(a.methods) == 0 {
+		return nil, errors.New("jwt auth needs JWT_SECRET or JWT_JWKS_FILE, or remove jwt from AUTH_METHODS")
+	}
+	return a, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(token string) (*models.AuthToken, error) {
+	var claims Claims
+	parser := jwt.NewParser(jwt.WithValidMethods(a.methods))
+
+	_, err := parser.ParseWithClaims(token, &claims, a.keyFunc)
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+			return nil, ErrTokenExpired
+		}
+		return nil, ErrInvalidToken
+	}
+
+	// Valid() only checks exp/nbf when present; require exp and check iss/aud
+	now := time.Now()
+	if !claims.VerifyExpiresAt(now, true) {
+		return nil, ErrTokenExpired
+	}
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return nil, ErrInvalidToken
+	}
+	if a.audience != "" && !claims.VerifyAudience(a.audience, true) {
+		return nil, ErrInvalidToken
+	}
+
+	subject := claims.UserID
+	if subject == "" {
+		subject = claims.Subject
+	}
+	userID, err := primitive.ObjectIDFromHex(subject)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	username := claims.Username
+	if username == "" {
+		username = claims.Email
+	}
+
+	return &models.AuthToken{
+		UserID:    userID,
+		Username:  username,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+// keyFunc picks the verification key for the token's algorithm
+func (a *JWTAuthenticator) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		return a.secret, nil
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+	default:
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+
+	key, err := a.lookupKey(token)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); ok {
+			return key, nil
+		}
+	case *ecdsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodECDSA); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("key type does not match signing method %s", token.Method.Alg())
+}
+
+// lookupKey finds the JWKS key named by the "kid" header. Tokens without a
+// kid are accepted only when the key set holds a single key.
+func (a *JWTAuthenticator) lookupKey(token *jwt.Token) (interface{}, error) {
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		if key, exists := a.keys[kid]; exists {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	if len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key, nil
+		}
+	}
+	return nil, errors.New("token has no key id")
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-ubipay-websocket/config"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testSecret = "test-secret"
+
+func b64(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+// writeJWKS writes the public keys to a JWKS file and returns its path
+func writeJWKS(t *testing.T, rsaKeys map[string]*rsa.PrivateKey, ecKeys map[string]*ecdsa.PrivateKey) string {
+	t.Helper()
+	var keys []jsonWebKey
+	for kid, key := range rsaKeys {
+		keys = append(keys, jsonWebKey{Kty: "RSA", Kid: kid, Use: "sig", N: b64(key.N), E: b64(big.NewInt(int64(key.E)))})
+	}
+	for kid, key := range ecKeys {
+		keys = append(keys, jsonWebKey{Kty: "EC", Kid: kid, Crv: "P-256", X: b64(key.X), Y: b64(key.Y)})
+	}
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestNewJWTAuthenticator(t *testing.T) {
+	if _, err := NewJWTAuthenticator(&config.Config{}); err == nil {
+		t.Error("accepted a config without JWT_SECRET or JWT_JWKS_FILE")
+	}
+	for secret := range placeholderSecrets {
+		if _, err := NewJWTAuthenticator(&config.Config{JWTSecret: secret}); err == nil {
+			t.Errorf("accepted the example secret %q", secret)
+		}
+	}
+	if _, err := NewJWTAuthenticator(&config.Config{JWTSecret: testSecret}); err != nil {
+		t.Errorf("rejected a random secret: %v", err)
+	}
+}
+
+func TestJWTAuthenticate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewJWTAuthenticator(&config.Config{
+		JWTSecret:   testSecret,
+		JWTIssuer:   "ubipay",
+		JWTAudience: "extension",
+		JWTJWKSFile: writeJWKS(t, map[string]*rsa.PrivateKey{"rsa": rsaKey}, map[string]*ecdsa.PrivateKey{"ec": ecKey}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID := primitive.NewObjectID()
+	claims := func(edit func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"sub":      userID.Hex(),
+			"username": "alice",
+			"iss":      "ubipay",
+			"aud":      "extension",
+			"exp":      time.Now().Add(time.Hour).Unix(),
+		}
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+	hs256 := func(edit func(jwt.MapClaims)) string {
+		return sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(edit))
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"HS256", hs256(nil), nil},
+		{"user_id claim", hs256(func(c jwt.MapClaims) { c["sub"] = "x"; c["user_id"] = userID.Hex() }), nil},
+		{"RS256 with kid", sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(nil)), nil},
+		{"ES256 with kid", sign(t, jwt.SigningMethodES256, "ec", ecKey, claims(nil)), nil},
+
+		{"wrong secret", sign(t, jwt.SigningMethodHS256, "", []byte("other"), claims(nil)), ErrInvalidToken},
+		{"alg none", sign(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, claims(nil)), ErrInvalidToken},
+		{"alg not allowed", sign(t, jwt.SigningMethodHS384, "", []byte(testSecret), claims(nil)), ErrInvalidToken},
+		{"expired", hs256(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }), ErrTokenExpired},
+		{"no exp", hs256(func(c jwt.MapClaims) { delete(c, "exp") }), ErrTokenExpired},
+		{"wrong issuer", hs256(func(c jwt.MapClaims) { c["iss"] = "someone-else" }), ErrInvalidToken},
+		{"no issuer", hs256(func(c jwt.MapClaims) { delete(c, "iss") }), ErrInvalidToken},
+		{"wrong audience", hs256(func(c jwt.MapClaims) { c["aud"] = "someone-else" }), ErrInvalidToken},
+		{"no audience", hs256(func(c jwt.MapClaims) { delete(c, "aud") }), ErrInvalidToken},
+		{"subject not an ObjectID", hs256(func(c jwt.MapClaims) { c["sub"] = "alice" }), ErrInvalidToken},
+		{"unknown kid", sign(t, jwt.SigningMethodRS256, "missing", rsaKey, claims(nil)), ErrInvalidToken},
+		{"no kid with several keys", sign(t, jwt.SigningMethodRS256, "", rsaKey, claims(nil)), ErrInvalidToken},
+		{"signed by another key", sign(t, jwt.SigningMethodRS256, "rsa", otherRSAKey, claims(nil)), ErrInvalidToken},
+		{"ES256 naming an RSA key", sign(t, jwt.SigningMethodES256, "rsa", ecKey, claims(nil)), ErrInvalidToken},
+		{"RS256 naming an EC key", sign(t, jwt.SigningMethodRS256, "ec", rsaKey, claims(nil)), ErrInvalidToken},
+		{"garbage", "not.a.token", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := a.Authenticate(tt.token)
+			if err != tt.err {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err == nil && (identity.UserID != userID || identity.Username != "alice") {
+				t.Errorf("identity = %+v, want alice (%s)", identity, userID.Hex())
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticateJWKSOnly(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewJWTAuthenticator(&config.Config{
+		JWTJWKSFile: writeJWKS(t, map[string]*rsa.PrivateKey{"rsa": rsaKey}, nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := jwt.MapClaims{"sub": primitive.NewObjectID().Hex(), "exp": time.Now().Add(time.Hour).Unix()}
+
+	// A single key is used for tokens without a kid
+	if _, err := a.Authenticate(sign(t, jwt.SigningMethodRS256, "", rsaKey, claims)); err != nil {
+		t.Errorf("RS256 without kid: %v", err)
+	}
+
+	// Without JWT_SECRET, HS256 is off; signing with the public key as the
+	// HMAC secret must not work either
+	publicKey := rsaKey.PublicKey.N.Bytes()
+	if _, err := a.Authenticate(sign(t, jwt.SigningMethodHS256, "", publicKey, claims)); err != ErrInvalidToken {
+		t.Errorf("HS256 without JWT_SECRET: err = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"go-ubipay-websocket/database"
+	"go-ubipay-websocket/models"
+)
+
+// SessionTokenAuthenticator validates opaque tokens against TblUser.SessionToken
+type SessionTokenAuthenticator struct {
+	users database.UserStore
+}
+
+func NewSessionTokenAuthenticator(users database.UserStore) *SessionTokenAuthenticator {
+	return &SessionTokenAuthenticator{users: users}
+}
+
+func (a *SessionTokenAuthenticator) Authenticate(token string) (*models.AuthToken, error) {
+	user, err := a.users.GetUserBySessionToken(token)
+	if err != nil {
+		if err == database.ErrUserNotFound {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if !user.Enable {
+		return nil, ErrUserDisabled
+	}
+
+	return &models.AuthToken{
+		UserID:   user.ID,
+		Username: user.Username,
+	}, nil
+}
@@ -4,8 +4,11 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"go-ubipay-websocket/points"
+
 	"github.com/joho/godotenv"
 )
 
@@ -14,9 +17,76 @@ type Config struct {
 	MongoDBURI        string
 	MongoDBName       string
 	JWTSecret         string
-	AccrualInterval   time.Duration
-	PointsPerMinute   int
 	HeartbeatInterval time.Duration
+	// Sessions that miss HeartbeatMaxMissed heartbeats in a row are
+	// disconnected by a reaper that runs every SessionReapInterval
+	HeartbeatMaxMissed  int
+	SessionReapInterval time.Duration
+	// Outbound messages per session are buffered up to SendQueueSize; when the
+	// queue is full SendQueuePolicy ("drop-oldest" or "disconnect") applies
+	SendQueueSize   int
+	SendQueuePolicy string
+	// A user may hold up to MaxConnectionsPerUser connections (0 = unlimited);
+	// beyond that ConnectionPolicy ("kick-oldest" or "reject-new") applies
+	MaxConnectionsPerUser int
+	ConnectionPolicy      string
+
+	// Accrual job runs every AccrualInterval, or on AccrualSchedule (a cron
+	// expression) when set. Users earn AccrualPoints per AccrualPeriod of
+	// connected time, independent of how often the job runs.
+	AccrualInterval time.Duration
+	AccrualSchedule string
+	AccrualPoints   points.Points
+	AccrualPeriod   time.Duration
+	// MinSettlementPoints is the smallest final accrual credited on disconnect;
+	// the default, one unit, credits any final window that earned something
+	MinSettlementPoints points.Points
+	// Accrual caps per UTC day, ISO week (Monday to Sunday, UTC) and
+	// lifetime; 0 means no cap
+	AccrualDailyCap    points.Points
+	AccrualWeeklyCap   points.Points
+	AccrualLifetimeCap points.Points
+	// AccrualRatesFile is a JSON rate table; when unset the rates are read
+	// from the TblAccrualRate collection
+	AccrualRatesFile string
+	// ReferralPercentages[i] is the percentage of a user's accrual paid to
+	// the referrer i+1 levels up; empty disables referral bonuses
+	ReferralPercentages []points.Points
+	// CampaignSchedule is how often boost campaigns are reloaded and their
+	// start and end announced
+	CampaignSchedule string
+
+	// ReconcileSchedule is the cron spec of the ledger reconciliation job,
+	// "off" disables it; ReconcileAutoCorrect writes compensating entries
+	ReconcileSchedule    string
+	ReconcileAutoCorrect bool
+
+	// DatabaseMode is one of "strict", "fallback" or "memory"
+	DatabaseMode        string
+	DBReconnectInterval time.Duration
+
+	// AuthMode decides how upgrades without a token are handled:
+	// "required", "optional-guest" or "dev-fixed-user"
+	AuthMode string
+	// AuthTimeout is how long a guest connection may stay unauthenticated
+	AuthTimeout time.Duration
+	// AuthRevalidateInterval re-checks the token of every live session, 0
+	// disables it; AuthWatchUsers also reacts to TblUser changes immediately
+	AuthRevalidateInterval time.Duration
+	AuthWatchUsers         bool
+	// AuthMethods is the comma-separated authenticator chain: "jwt", "session"
+	AuthMethods string
+	// Signed JWTs use HS256 with JWTSecret, or RS256/ES256 with the keys in
+	// JWTJWKSFile; iss and aud are checked when set
+	JWTIssuer   string
+	JWTAudience string
+	JWTJWKSFile string
+
+	// AdminAPIKeys is a comma-separated list of name:key:role entries;
+	// AdminUserTypes maps TblUser.UserType to a role for token callers
+	// ("userType:role,..."). Roles are "read-only" and "operator".
+	AdminAPIKeys   string
+	AdminUserTypes string
 }
 
 func LoadConfig() *Config {
@@ -33,10 +103,48 @@ func LoadConfig() *Config {
 		ServerPort:        getEnv("SERVER_PORT", "3124"),
 		MongoDBURI:        getEnv("MONGODB_URI", "mongodb://localhost:27017"),
 		MongoDBName:       getEnv("MONGODB_NAME", "ubipay"),
-		JWTSecret:         getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-		AccrualInterval:   getDurationEnv("ACCRUAL_INTERVAL", time.Minute),
-		PointsPerMinute:   getIntEnv("POINTS_PER_MINUTE", 1),
+		JWTSecret:         getEnv("JWT_SECRET", ""),
 		HeartbeatInterval: getDurationEnv("HEARTBEAT_INTERVAL", 30*time.Second),
+
+		HeartbeatMaxMissed:  getIntEnv("HEARTBEAT_MAX_MISSED", 3),
+		SessionReapInterval: getDurationEnv("SESSION_REAP_INTERVAL", 10*time.Second),
+		SendQueueSize:       getIntEnv("SEND_QUEUE_SIZE", 64),
+		SendQueuePolicy:     getEnv("SEND_QUEUE_POLICY", "drop-oldest"),
+
+		MaxConnectionsPerUser: getIntEnv("MAX_CONNECTIONS_PER_USER", 3),
+		ConnectionPolicy:      getEnv("CONNECTION_POLICY", "kick-oldest"),
+
+		AccrualInterval: getDurationEnv("ACCRUAL_INTERVAL", time.Minute),
+		AccrualSchedule: getEnv("ACCRUAL_SCHEDULE", ""),
+		// POINTS_PER_MINUTE is kept as the default for existing deployments
+		AccrualPoints:       getPointsEnv("ACCRUAL_POINTS", getPointsEnv("POINTS_PER_MINUTE", points.One)),
+		AccrualPeriod:       getDurationEnv("ACCRUAL_PERIOD", time.Minute),
+		MinSettlementPoints: getPointsEnv("MIN_SETTLEMENT_POINTS", 1),
+		AccrualDailyCap:     getPointsEnv("ACCRUAL_DAILY_CAP", 0),
+		AccrualWeeklyCap:    getPointsEnv("ACCRUAL_WEEKLY_CAP", 0),
+		AccrualLifetimeCap:  getPointsEnv("ACCRUAL_LIFETIME_CAP", 0),
+		AccrualRatesFile:    getEnv("ACCRUAL_RATES_FILE", ""),
+		ReferralPercentages: getPointsListEnv("REFERRAL_PERCENTAGES"),
+		CampaignSchedule:    getEnv("CAMPAIGN_SCHEDULE", "@every 30s"),
+
+		ReconcileSchedule:    getEnv("RECONCILE_SCHEDULE", "@every 1h"),
+		ReconcileAutoCorrect: getBoolEnv("RECONCILE_AUTO_CORRECT", false),
+
+		DatabaseMode:        getEnv("DB_MODE", "fallback"),
+		DBReconnectInterval: getDurationEnv("DB_RECONNECT_INTERVAL", 30*time.Second),
+
+		AuthMode:    getEnv("AUTH_MODE", "required"),
+		AuthTimeout: getDurationEnv("AUTH_TIMEOUT", 30*time.Second),
+		AuthMethods: getEnv("AUTH_METHODS", "jwt,session"),
+		JWTIssuer:   getEnv("JWT_ISSUER", ""),
+		JWTAudience: getEnv("JWT_AUDIENCE", ""),
+		JWTJWKSFile: getEnv("JWT_JWKS_FILE", ""),
+
+		AuthRevalidateInterval: getDurationEnv("AUTH_REVALIDATE_INTERVAL", time.Minute),
+		AuthWatchUsers:         getBoolEnv("AUTH_WATCH_USERS", false),
+
+		AdminAPIKeys:   getEnv("ADMIN_API_KEYS", ""),
+		AdminUserTypes: getEnv("ADMIN_USER_TYPES", ""),
 	}
 }
 
@@ -64,3 +172,44 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	}
 	return defaultValue
 }
+
+func getBoolEnv(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// getPointsEnv parses a decimal points value such as "1" or "0.25"
+func getPointsEnv(key string, defaultValue points.Points) points.Points {
+	if value := os.Getenv(key); value != "" {
+		parsed, err := points.Parse(value)
+		if err == nil {
+			return parsed
+		}
+		log.Printf("⚠️ Ignoring %s=%q: %v", key, value, err)
+	}
+	return defaultValue
+}
+
+// getPointsListEnv parses a comma separated list of points values such as
+// "10,5,2.5"; an invalid list is ignored as a whole
+func getPointsListEnv(key string) []points.Points {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+
+	var list []points.Points
+	for _, item := range strings.Split(value, ",") {
+		parsed, err := points.Parse(strings.TrimSpace(item))
+		if err != nil {
+			log.Printf("⚠️ Ignoring %s=%q: %v", key, value, err)
+			return nil
+		}
+		list = append(list, parsed)
+	}
+	return list
+}
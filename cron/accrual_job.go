@@ -2,46 +2,64 @@ package cron
 
 import (
 	"log"
+	"sync"
 	"time"
 
+	"go-ubipay-websocket/accrual"
 	"go-ubipay-websocket/config"
 	"go-ubipay-websocket/database"
 	"go-ubipay-websocket/websocket"
 
-	"strconv"
-	"strings"
-
 	"github.com/robfig/cron/v3"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type AccrualJob struct {
 	cfg            *config.Config
 	sessionManager *websocket.SessionManager
-	db             *database.Database
+	db             database.Store
 	wsHandler      *websocket.WebSocketHandler
+	accruer        *accrual.Accruer
 	cron           *cron.Cron
+	// runMu serialises scheduled and manual runs
+	runMu sync.Mutex
 }
 
-func NewAccrualJob(cfg *config.Config, sessionManager *websocket.SessionManager, db *database.Database, wsHandler *websocket.WebSocketHandler) *AccrualJob {
+func NewAccrualJob(cfg *config.Config, sessionManager *websocket.SessionManager, db database.Store, wsHandler *websocket.WebSocketHandler, accruer *accrual.Accruer) *AccrualJob {
 	return &AccrualJob{
 		cfg:            cfg,
 		sessionManager: sessionManager,
 		db:             db,
 		wsHandler:      wsHandler,
+		accruer:        accruer,
 		cron:           cron.New(),
 	}
 }
 
+// Schedule returns the cron spec the accrual job runs on: ACCRUAL_SCHEDULE
+// if set, otherwise every ACCRUAL_INTERVAL
+func (j *AccrualJob) Schedule() string {
+	if j.cfg.AccrualSchedule != "" {
+		return j.cfg.AccrualSchedule
+	}
+	return "@every " + j.cfg.AccrualInterval.String()
+}
+
 func (j *AccrualJob) Start() {
-	// Schedule accrual job to run every minute
-	_, err := j.cron.AddFunc("@every 1m", j.runAccrual)
+	if j.cfg.AccrualSchedule == "" && j.cfg.AccrualInterval <= 0 {
+		log.Fatalf("❌ Invalid ACCRUAL_INTERVAL: %v", j.cfg.AccrualInterval)
+	}
+	if j.cfg.AccrualPeriod <= 0 {
+		log.Fatalf("❌ Invalid ACCRUAL_PERIOD: %v", j.cfg.AccrualPeriod)
+	}
+
+	_, err := j.cron.AddFunc(j.Schedule(), j.runAccrual)
 	if err != nil {
 		log.Fatalf("❌ Failed to schedule accrual job: %v", err)
 	}
 
 	j.cron.Start()
-	log.Println("✅ Accrual cron job started - running every minute")
+	log.Printf("✅ Accrual cron job started - schedule %q, %s points per %v",
+		j.Schedule(), j.cfg.AccrualPoints, j.cfg.AccrualPeriod)
 }
 
 func (j *AccrualJob) Stop() {
@@ -49,69 +67,119 @@ func (j *AccrualJob) Stop() {
 	log.Println("🛑 Accrual cron job stopped")
 }
 
-func Decimal128ToInt(d primitive.Decimal128) int {
-	s := d.String()              // 例如 "3.0"
-	s = strings.Split(s, ".")[0] // 取整数部分
-	i, err := strconv.Atoi(s)
-	if err != nil {
-		return 0
-	}
-	return i
-}
-
 func (j *AccrualJob) runAccrual() {
+	j.runMu.Lock()
+	defer j.runMu.Unlock()
+
 	startTime := time.Now()
 	log.Printf("⏰ Starting accrual process at %s", startTime.Format("2006-01-02 15:04:05"))
 
-	activeSessions := j.sessionManager.GetActiveSessions()
-	log.Printf("📊 Found %d active sessions", len(activeSessions))
+	// Users with several connections are credited once
+	activeUsers := j.sessionManager.GetActiveUsers()
+	log.Printf("📊 Found %d active users", len(activeUsers))
 
-	if len(activeSessions) == 0 {
+	if len(activeUsers) == 0 {
 		log.Println("ℹ️ No active sessions found, skipping accrual")
 		return
 	}
 
 	successCount := 0
 	failureCount := 0
+	skippedCount := 0
+
+	for _, user := range activeUsers {
+		// Pick up UserVip / UserType changes before crediting the window
+		j.wsHandler.RefreshTier(user.UserID)
 
-	for _, session := range activeSessions {
-		if !session.IsActive {
+		result, exists, err := j.accrueUser(user, startTime)
+		if !exists {
+			continue
+		}
+		if err == database.ErrDuplicateTransaction {
+			skippedCount++
 			continue
 		}
-
-		pointsToAward := j.cfg.PointsPerMinute
-
-		// 给用户加积分
-		err := j.db.AccruePoints(session.UserID, session.Username, pointsToAward)
 		if err != nil {
-			log.Printf("❌ Failed to accrue points for user %s: %v", session.Username, err)
+			log.Printf("❌ Failed to accrue points for user %s: %v", user.Username, err)
 			failureCount++
 			continue
 		}
-
-		j.sessionManager.UpdateLastAccrual(session.UserID)
+		if result.Points == 0 {
+			skippedCount++
+			continue
+		}
 
 		// 获取最新钱包余额
-		wallet, _ := j.db.GetUserWallet(session.UserID)
-		if wallet == nil {
-			log.Printf("⚠️ Failed to get updated balance for user %s", session.Username)
+		wallet, err := j.db.GetUserWallet(user.UserID)
+		if err != nil {
+			log.Printf("⚠️ Failed to get updated balance for user %s: %v", user.Username, err)
+			continue
+		}
+		balance, err := database.BalanceOf(wallet)
+		if err != nil {
+			log.Printf("⚠️ Failed to read updated balance for user %s: %v", user.Username, err)
 			continue
 		}
 
-		balance := Decimal128ToInt(wallet.Balance)
+		// WebSocket 通知 (all of the user's connections)
+		for _, wsSession := range j.sessionManager.GetUserSessions(user.UserID) {
+			if wsSession.Info().IsActive {
+				j.wsHandler.SendAccrualNotification(wsSession, result.Points, balance)
+				if len(result.Exhausted) > 0 {
+					j.wsHandler.SendCapReached(wsSession, result.Exhausted)
+				}
+			}
+		}
+		for _, capUsage := range result.Exhausted {
+			log.Printf("⛔ User %s reached the %s accrual cap of %s points", user.Username, capUsage.Period, capUsage.Cap)
+		}
 
-		// WebSocket 通知
-		wsSession, exists := j.sessionManager.GetSession(session.UserID)
-		if exists && wsSession.IsActive {
-			j.wsHandler.SendAccrualNotification(wsSession, pointsToAward, balance)
+		// Referrers that are online see their bonus right away
+		for _, bonus := range result.Referrals {
+			j.wsHandler.BroadcastBalanceUpdate(bonus.UserID, bonus.AfterAmt)
 		}
 
-		log.Printf("💰 Accrued %d points for user %s, new balance: %d", pointsToAward, session.Username, balance)
+		if result.Boost > 0 {
+			log.Printf("🎉 Campaign %s boosted user %s by %sx", result.CampaignID.Hex(), user.Username, result.Boost)
+		}
+		log.Printf("💰 Accrued %s points for user %s, new balance: %s", result.Points, user.Username, balance)
 		successCount++
 	}
 
 	duration := time.Since(startTime)
-	log.Printf("✅ Accrual process completed in %v - Success: %d, Failures: %d", duration, successCount, failureCount)
+	log.Printf("✅ Accrual process completed in %v - Success: %d, Failures: %d, Skipped: %d",
+		duration, successCount, failureCount, skippedCount)
+}
+
+// accrueUser credits the user's window up to to under the user's accrual
+// lock. exists is false when the user's last connection closed meanwhile;
+// the disconnect settlement credits that window.
+func (j *AccrualJob) accrueUser(user websocket.ActiveUser, to time.Time) (result accrual.Result, exists bool, err error) {
+	group := j.sessionManager.LockAccrual(user.UserID)
+	if group == nil {
+		return accrual.Result{}, false, nil
+	}
+	defer group.UnlockAccrual()
+
+	// 按实际在线时长给用户加积分
+	from, carry, tier := j.sessionManager.AccrualStateOf(group)
+	result, err = j.accruer.Accrue(user.UserID, user.Username, from, to, carry, tier)
+	if err == database.ErrDuplicateTransaction {
+		// Windows are credited under the accrual lock, so this one was
+		// credited by an earlier run whose caller saw an error (e.g. an
+		// unknown commit result). Move past it, or every later run rebuilds
+		// the same key.
+		log.Printf("⏭️ Accrual window of user %s from %s was already credited, moving on",
+			user.Username, from.Format("2006-01-02 15:04:05"))
+		j.sessionManager.UpdateLastAccrual(group, to, nil)
+		return result, true, err
+	}
+	if err != nil {
+		return result, true, err
+	}
+
+	j.sessionManager.UpdateLastAccrual(group, to, result.Carry)
+	return result, true, nil
 }
 
 func (j *AccrualJob) RunManualAccrual() {
@@ -0,0 +1,75 @@
+package cron
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"go-ubipay-websocket/accrual"
+	"go-ubipay-websocket/config"
+	"go-ubipay-websocket/models"
+	"go-ubipay-websocket/websocket"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CampaignJob keeps the accruer's campaign cache fresh and announces
+// campaigns to connected clients when they start and end
+type CampaignJob struct {
+	cfg       *config.Config
+	accruer   *accrual.Accruer
+	wsHandler *websocket.WebSocketHandler
+
+	mu     sync.Mutex
+	active map[primitive.ObjectID]models.Campaign
+}
+
+func NewCampaignJob(cfg *config.Config, accruer *accrual.Accruer, wsHandler *websocket.WebSocketHandler) *CampaignJob {
+	return &CampaignJob{
+		cfg:       cfg,
+		accruer:   accruer,
+		wsHandler: wsHandler,
+		active:    make(map[primitive.ObjectID]models.Campaign),
+	}
+}
+
+// Register loads the campaigns and adds the job to the scheduler's cron
+func (j *CampaignJob) Register(scheduler *AccrualJob) {
+	j.Check()
+
+	_, err := scheduler.cron.AddFunc(j.cfg.CampaignSchedule, j.Check)
+	if err != nil {
+		log.Fatalf("❌ Failed to schedule campaign job: %v", err)
+	}
+	log.Printf("✅ Campaign job scheduled - %q", j.cfg.CampaignSchedule)
+}
+
+// Check reloads the campaigns and announces the ones that started or ended
+// since the last check. A campaign that is disabled early counts as ended.
+func (j *CampaignJob) Check() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.accruer.LoadCampaigns(); err != nil {
+		log.Printf("❌ Failed to load campaigns: %v", err)
+		return
+	}
+
+	now := time.Now()
+	active := make(map[primitive.ObjectID]models.Campaign)
+	for _, campaign := range j.accruer.ActiveCampaigns(now) {
+		active[campaign.ID] = campaign
+		if _, running := j.active[campaign.ID]; !running {
+			n := j.wsHandler.AnnounceCampaign(websocket.CampaignStarted, campaign)
+			log.Printf("🎉 Campaign %q started (%sx until %s), %d connections notified",
+				campaign.Name, campaign.Multiplier, campaign.EndAt.Format("2006-01-02 15:04:05"), n)
+		}
+	}
+	for id, campaign := range j.active {
+		if _, running := active[id]; !running {
+			n := j.wsHandler.AnnounceCampaign(websocket.CampaignEnded, campaign)
+			log.Printf("🏁 Campaign %q ended, %d connections notified", campaign.Name, n)
+		}
+	}
+	j.active = active
+}
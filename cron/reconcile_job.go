@@ -0,0 +1,45 @@
+package cron
+
+import (
+	"log"
+
+	"go-ubipay-websocket/config"
+	"go-ubipay-websocket/reconcile"
+)
+
+// ReconcileScheduleOff disables the scheduled reconciliation; the admin
+// endpoint still runs it on demand
+const ReconcileScheduleOff = "off"
+
+// ReconcileJob runs the ledger reconciliation on the accrual job's cron
+type ReconcileJob struct {
+	cfg        *config.Config
+	reconciler *reconcile.Reconciler
+}
+
+func NewReconcileJob(cfg *config.Config, reconciler *reconcile.Reconciler) *ReconcileJob {
+	return &ReconcileJob{
+		cfg:        cfg,
+		reconciler: reconciler,
+	}
+}
+
+// Register adds the job to the scheduler's cron
+func (j *ReconcileJob) Register(scheduler *AccrualJob) {
+	if j.cfg.ReconcileSchedule == ReconcileScheduleOff {
+		log.Println("ℹ️ Scheduled ledger reconciliation disabled")
+		return
+	}
+
+	_, err := scheduler.cron.AddFunc(j.cfg.ReconcileSchedule, j.run)
+	if err != nil {
+		log.Fatalf("❌ Failed to schedule reconciliation job: %v", err)
+	}
+	log.Printf("✅ Ledger reconciliation scheduled - %q, auto-correct: %v", j.cfg.ReconcileSchedule, j.cfg.ReconcileAutoCorrect)
+}
+
+func (j *ReconcileJob) run() {
+	if _, err := j.reconciler.Run(j.cfg.ReconcileAutoCorrect, false); err != nil {
+		log.Printf("❌ Ledger reconciliation failed: %v", err)
+	}
+}
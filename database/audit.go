@@ -0,0 +1,22 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go-ubipay-websocket/models"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (db *MongoStore) InsertAdminAudit(entry *models.AdminAuditLog) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := db.AdminAuditCollection.InsertOne(ctx, entry)
+	// A fallback migration retries entries that were already copied
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
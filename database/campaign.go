@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go-ubipay-websocket/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (db *MongoStore) ListCampaigns(endedAfter time.Time) ([]models.Campaign, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if !endedAfter.IsZero() {
+		filter["EndAt"] = bson.M{"$gt": endedAfter}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "StartAt", Value: 1}})
+
+	cursor, err := db.CampaignCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	campaigns := make([]models.Campaign, 0)
+	if err := cursor.All(ctx, &campaigns); err != nil {
+		return nil, err
+	}
+	return campaigns, nil
+}
+
+func (db *MongoStore) InsertCampaign(campaign *models.Campaign) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if campaign.ID.IsZero() {
+		campaign.ID = primitive.NewObjectID()
+	}
+	_, err := db.CampaignCollection.InsertOne(ctx, campaign)
+	return err
+}
+
+func (db *MongoStore) DisableCampaign(campaignID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := db.CampaignCollection.UpdateByID(ctx, campaignID, bson.M{"$set": bson.M{"Enable": false}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrCampaignNotFound
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-ubipay-websocket/models"
+	"go-ubipay-websocket/points"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Cap periods
+const (
+	CapDaily    = "daily"
+	CapWeekly   = "weekly"
+	CapLifetime = "lifetime"
+)
+
+// AccrualCaps limits how many points a user can accrue per UTC day, ISO week
+// and in total. A zero cap is disabled.
+type AccrualCaps struct {
+	Daily    points.Points
+	Weekly   points.Points
+	Lifetime points.Points
+}
+
+func (c AccrualCaps) Enabled() bool {
+	return c.Daily > 0 || c.Weekly > 0 || c.Lifetime > 0
+}
+
+// CapUsage is a user's accrual total against one cap. ResetsAt is nil for
+// the lifetime cap.
+type CapUsage struct {
+	Period    string        `json:"period"`
+	Cap       points.Points `json:"cap"`
+	Used      points.Points `json:"used"`
+	Remaining points.Points `json:"remaining"`
+	ResetsAt  *time.Time    `json:"resets_at,omitempty"`
+
+	// key is the AccrualCounter Period, start the first instant of the window
+	key   string
+	start time.Time
+}
+
+// Allowance is a user's usage of every enabled cap. Remaining is the
+// smallest remaining amount, i.e. how much can still be accrued right now.
+type Allowance struct {
+	Remaining points.Points `json:"remaining"`
+	Caps      []CapUsage    `json:"caps"`
+}
+
+// AccrualOutcome is what AccruePoints credited. Exhausted lists the caps the
+// credit used up, so callers can tell the user once; Referrals are the
+// bonus rows paid with it.
+type AccrualOutcome struct {
+	Credited  points.Points
+	Exhausted []CapUsage
+	Referrals []*models.TransactionMovement
+}
+
+// windows returns an empty usage entry for every enabled cap at now
+func (c AccrualCaps) windows(now time.Time) []CapUsage {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	windows := make([]CapUsage, 0, 3)
+
+	if c.Daily > 0 {
+		end := day.AddDate(0, 0, 1)
+		windows = append(windows, CapUsage{
+			Period:   CapDaily,
+			Cap:      c.Daily,
+			ResetsAt: &end,
+			key:      CapDaily + ":" + day.Format("2006-01-02"),
+			start:    day,
+		})
+	}
+	if c.Weekly > 0 {
+		// ISO weeks start on Monday
+		start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		end := start.AddDate(0, 0, 7)
+		year, week := start.ISOWeek()
+		windows = append(windows, CapUsage{
+			Period:   CapWeekly,
+			Cap:      c.Weekly,
+			ResetsAt: &end,
+			key:      fmt.Sprintf("%s:%04d-W%02d", CapWeekly, year, week),
+			start:    start,
+		})
+	}
+	if c.Lifetime > 0 {
+		windows = append(windows, CapUsage{
+			Period: CapLifetime,
+			Cap:    c.Lifetime,
+			key:    CapLifetime,
+		})
+	}
+	return windows
+}
+
+func (u *CapUsage) setUsed(used points.Points) {
+	u.Used = used
+	u.Remaining = u.Cap - used
+	if u.Remaining < 0 {
+		u.Remaining = 0
+	}
+}
+
+func newAllowance(usage []CapUsage) *Allowance {
+	allowance := &Allowance{Caps: usage}
+	for i, u := range usage {
+		if i == 0 || u.Remaining < allowance.Remaining {
+			allowance.Remaining = u.Remaining
+		}
+	}
+	return allowance
+}
+
+// take clamps amount to the remaining allowance and returns the usage after
+// crediting it. Without caps amount is returned unchanged.
+func (a *Allowance) take(amount points.Points) (*AccrualOutcome, []CapUsage, error) {
+	if len(a.Caps) == 0 {
+		return &AccrualOutcome{Credited: amount}, nil, nil
+	}
+	if a.Remaining <= 0 {
+		return nil, nil, ErrCapReached
+	}
+
+	outcome := &AccrualOutcome{Credited: amount}
+	if amount > a.Remaining {
+		outcome.Credited = a.Remaining
+	}
+
+	after := make([]CapUsage, len(a.Caps))
+	for i, u := range a.Caps {
+		u.setUsed(u.Used + outcome.Credited)
+		if u.Remaining == 0 {
+			outcome.Exhausted = append(outcome.Exhausted, u)
+		}
+		after[i] = u
+	}
+	return outcome, after, nil
+}
+
+// isAccrual reports whether a ledger row counts towards the accrual caps
+func isAccrual(t *models.TransactionMovement) bool {
+	return t.TargetType == models.TargetTypePointAccrual && t.TransactionType == models.TransactionTypeCredit
+}
+
+// accrualAllowance reads the user's counters. A window without a counter
+// (first accrual of the window, or caps enabled on an existing deployment)
+// is seeded from the ledger.
+func (db *MongoStore) accrualAllowance(ctx context.Context, userID primitive.ObjectID, caps AccrualCaps, now time.Time) (*Allowance, error) {
+	usage := caps.windows(now)
+	for i := range usage {
+		var counter models.AccrualCounter
+		err := db.CounterCollection.FindOne(ctx, bson.M{"UserID": userID, "Period": usage[i].key}).Decode(&counter)
+		switch err {
+		case nil:
+			usage[i].setUsed(counter.Total)
+		case mongo.ErrNoDocuments:
+			used, err := db.sumAccruals(ctx, userID, usage[i].start)
+			if err != nil {
+				return nil, err
+			}
+			usage[i].setUsed(used)
+		default:
+			return nil, err
+		}
+	}
+	return newAllowance(usage), nil
+}
+
+// sumAccruals adds up the user's accrual credits since the given time
+func (db *MongoStore) sumAccruals(ctx context.Context, userID primitive.ObjectID, since time.Time) (points.Points, error) {
+	match := bson.M{
+		"UserID":          userID,
+		"TargetType":      models.TargetTypePointAccrual,
+		"TransactionType": models.TransactionTypeCredit,
+	}
+	if !since.IsZero() {
+		match["CreateDate"] = bson.M{"$gte": since}
+	}
+
+	cursor, err := db.TransactionCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "Total": bson.M{"$sum": "$Amount"}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		Total points.Points `bson:"Total"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return 0, err
+		}
+	}
+	return result.Total, cursor.Err()
+}
+
+// saveCounters writes the usage totals after a credit
+func (db *MongoStore) saveCounters(ctx context.Context, userID primitive.ObjectID, usage []CapUsage) error {
+	for _, u := range usage {
+		set := bson.M{"Total": u.Used, "ModifiedDate": time.Now()}
+		if u.ResetsAt != nil {
+			set["ExpiresAt"] = *u.ResetsAt
+		}
+		_, err := db.CounterCollection.UpdateOne(ctx,
+			bson.M{"UserID": userID, "Period": u.key},
+			bson.M{"$set": set},
+			options.Update().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *MongoStore) AccrualAllowance(userID primitive.ObjectID, caps AccrualCaps) (*Allowance, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return db.accrualAllowance(ctx, userID, caps, time.Now())
+}
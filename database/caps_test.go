@@ -0,0 +1,88 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"go-ubipay-websocket/points"
+)
+
+func TestAccrualCapsWindows(t *testing.T) {
+	// Wednesday 2026-10-14 23:30 UTC, given in a zone where it is already Thursday
+	now := time.Date(2026, 10, 14, 23, 30, 0, 0, time.UTC).In(time.FixedZone("UTC+8", 8*3600))
+	caps := AccrualCaps{Daily: points.FromInt(10), Weekly: points.FromInt(50), Lifetime: points.FromInt(1000)}
+
+	windows := caps.windows(now)
+	if len(windows) != 3 {
+		t.Fatalf("got %d windows, want 3", len(windows))
+	}
+
+	daily, weekly, lifetime := windows[0], windows[1], windows[2]
+	if daily.Period != CapDaily || daily.key != "daily:2026-10-14" ||
+		!daily.start.Equal(time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC)) ||
+		!daily.ResetsAt.Equal(time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("daily window = %+v", daily)
+	}
+	if weekly.Period != CapWeekly || weekly.key != "weekly:2026-W42" ||
+		!weekly.start.Equal(time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)) ||
+		!weekly.ResetsAt.Equal(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("weekly window = %+v", weekly)
+	}
+	if lifetime.Period != CapLifetime || lifetime.key != CapLifetime || lifetime.ResetsAt != nil {
+		t.Errorf("lifetime window = %+v", lifetime)
+	}
+
+	// A Sunday still belongs to the week that started on Monday
+	sunday := AccrualCaps{Weekly: points.One}.windows(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	if len(sunday) != 1 || sunday[0].key != "weekly:2026-W42" {
+		t.Errorf("sunday windows = %+v", sunday)
+	}
+
+	if windows := (AccrualCaps{}).windows(now); len(windows) != 0 {
+		t.Errorf("disabled caps gave windows %+v", windows)
+	}
+}
+
+func TestAllowanceTake(t *testing.T) {
+	outcome, after, err := (&Allowance{}).take(points.FromInt(5))
+	if err != nil || outcome.Credited != points.FromInt(5) || after != nil {
+		t.Errorf("take without caps = %+v, %+v, %v", outcome, after, err)
+	}
+
+	usage := func(cap, used points.Points) CapUsage {
+		u := CapUsage{Cap: cap}
+		u.setUsed(used)
+		return u
+	}
+
+	allowance := newAllowance([]CapUsage{
+		usage(points.FromInt(10), points.FromInt(7)),
+		usage(points.FromInt(50), points.FromInt(20)),
+	})
+	outcome, after, err = allowance.take(points.FromInt(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outcome.Credited != points.FromInt(3) {
+		t.Errorf("credited %s, want 3", outcome.Credited)
+	}
+	if len(outcome.Exhausted) != 1 || outcome.Exhausted[0].Cap != points.FromInt(10) {
+		t.Errorf("exhausted = %+v, want the daily cap", outcome.Exhausted)
+	}
+	if after[0].Used != points.FromInt(10) || after[1].Used != points.FromInt(23) || after[1].Remaining != points.FromInt(27) {
+		t.Errorf("usage after = %+v", after)
+	}
+	if allowance.Caps[0].Used != points.FromInt(7) {
+		t.Errorf("take modified the allowance: %+v", allowance.Caps[0])
+	}
+
+	outcome, _, err = allowance.take(points.FromInt(2))
+	if err != nil || outcome.Credited != points.FromInt(2) || len(outcome.Exhausted) != 0 {
+		t.Errorf("take below the allowance = %+v, %v", outcome, err)
+	}
+
+	spent := newAllowance([]CapUsage{usage(points.FromInt(10), points.FromInt(12))})
+	if _, _, err := spent.take(points.One); err != ErrCapReached {
+		t.Errorf("take from a spent allowance: %v, want ErrCapReached", err)
+	}
+}
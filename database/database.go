@@ -9,9 +9,7 @@ import (
 
 	"go-ubipay-websocket/config"
 	"go-ubipay-websocket/models"
-
-	"strconv"
-	"strings"
+	"go-ubipay-websocket/points"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -20,22 +18,35 @@ import (
 )
 
 var (
-	ErrUserNotFound = errors.New("user not found")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	// ErrDuplicateTransaction is returned when a ledger row with the same
+	// idempotency key already exists; the balance is left unchanged.
+	ErrDuplicateTransaction = errors.New("duplicate transaction")
+	ErrWatchUnsupported     = errors.New("change streams are not supported by this store")
+	// ErrCapReached is returned by AccruePoints when an accrual cap has no
+	// allowance left; nothing is credited.
+	ErrCapReached       = errors.New("accrual cap reached")
+	ErrCampaignNotFound = errors.New("campaign not found")
 )
 
-type Database struct {
+// MongoStore is the MongoDB implementation of Store
+type MongoStore struct {
 	Client                *mongo.Client
 	UserWalletCollection  *mongo.Collection
 	TransactionCollection *mongo.Collection
-	TestMode              bool
 	User                  *mongo.Collection
-	mockWallets           map[primitive.ObjectID]*models.UserWallet
-	mockTransactions      []*models.TransactionMovement
+	AdminAuditCollection  *mongo.Collection
+	DiscrepancyCollection *mongo.Collection
+	CounterCollection     *mongo.Collection
+	RateCollection        *mongo.Collection
+	CampaignCollection    *mongo.Collection
+	CheckpointCollection  *mongo.Collection
 }
 
-var DB *Database
+var DB Store
 
-func ConnectMongoDB(cfg *config.Config) (*Database, error) {
+func ConnectMongoDB(cfg *config.Config) (*MongoStore, error) {
 	// Connect to MongoDB
 	clientOptions := options.Client().ApplyURI(cfg.MongoDBURI)
 
@@ -52,17 +63,29 @@ func ConnectMongoDB(cfg *config.Config) (*Database, error) {
 	err = client.Ping(ctx, nil)
 	if err != nil {
 		log.Printf("❌ MongoDB ping failed: %v", err)
+		client.Disconnect(context.Background())
 		return nil, err
 	}
 
 	db := client.Database(cfg.MongoDBName)
 
-	database := &Database{
+	database := &MongoStore{
 		Client:                client,
 		UserWalletCollection:  db.Collection("TblUserWallet"),
 		TransactionCollection: db.Collection("TblTransactionMovement"),
 		User:                  db.Collection("TblUser"),
-		TestMode:              false,
+		AdminAuditCollection:  db.Collection("TblAdminAuditLog"),
+		DiscrepancyCollection: db.Collection("TblLedgerDiscrepancy"),
+		CounterCollection:     db.Collection("TblAccrualCounter"),
+		RateCollection:        db.Collection("TblAccrualRate"),
+		CampaignCollection:    db.Collection("TblCampaign"),
+		CheckpointCollection:  db.Collection("TblReconcileCheckpoint"),
+	}
+
+	if err := database.EnsureIndexes(); err != nil {
+		log.Printf("❌ Failed to create MongoDB indexes: %v", err)
+		client.Disconnect(context.Background())
+		return nil, err
 	}
 
 	DB = database
@@ -70,33 +93,13 @@ func ConnectMongoDB(cfg *config.Config) (*Database, error) {
 	return database, nil
 }
 
-// NewTestDatabase creates a mock database for testing without MongoDB
-func NewTestDatabase() *Database {
-	log.Println("🔧 Using test database (MongoDB not available)")
-	return &Database{
-		mockWallets:      make(map[primitive.ObjectID]*models.UserWallet),
-		mockTransactions: make([]*models.TransactionMovement, 0),
-		TestMode:         true,
-	}
-}
-
-func (db *Database) Disconnect() error {
+func (db *MongoStore) Disconnect() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	return db.Client.Disconnect(ctx)
 }
 
-func (db *Database) GetUserWallet(userID primitive.ObjectID) (*models.UserWallet, error) {
-	if db.TestMode {
-		// Mock implementation for test mode
-		if wallet, exists := db.mockWallets[userID]; exists {
-			log.Printf("🔍 [TEST] Retrieved wallet for user %s - Balance: %d", userID.Hex(), wallet.Balance)
-			return wallet, nil
-		}
-		// Create a new wallet if it doesn't exist
-		return db.CreateUserWallet(userID)
-	}
-
+func (db *MongoStore) GetUserWallet(userID primitive.ObjectID) (*models.UserWallet, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -115,12 +118,7 @@ func (db *Database) GetUserWallet(userID primitive.ObjectID) (*models.UserWallet
 	return &wallet, nil
 }
 
-func (db *Database) GetUserBySessionToken(sessionToken string) (*models.User, error) {
-	// Check if User collection is available (test mode or not initialized)
-	if db.User == nil {
-		return nil, fmt.Errorf("user collection not available")
-	}
-
+func (db *MongoStore) GetUserBySessionToken(sessionToken string) (*models.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -138,27 +136,123 @@ func (db *Database) GetUserBySessionToken(sessionToken string) (*models.User, er
 	return &user, nil
 }
 
-// Decimal128 → int
-func decimal128ToInt(d primitive.Decimal128) int {
-	s := d.String() // "3.0"
-	s = strings.Split(s, ".")[0]
-	i, _ := strconv.Atoi(s)
-	return i
+func (db *MongoStore) GetUserByUsername(username string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	err := db.User.FindOne(ctx, bson.M{"Username": username}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (db *MongoStore) GetUserByID(userID primitive.ObjectID) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	err := db.User.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// BalanceOf returns the wallet balance; a balance that is not a valid
+// points value (NaN, too many decimals) is an error rather than zero
+func BalanceOf(wallet *models.UserWallet) (points.Points, error) {
+	balance, err := points.FromDecimal128(wallet.Balance)
+	if err != nil {
+		return 0, fmt.Errorf("wallet %s: %w", wallet.UserID.Hex(), err)
+	}
+	return balance, nil
 }
 
-// int → Decimal128
-func intToDecimal128(i int) primitive.Decimal128 {
-	d, _ := primitive.ParseDecimal128(strconv.Itoa(i))
-	return d
+// AccrualKey identifies the accrual credit for a user and accrual window so
+// that retried or double-triggered runs map to the same ledger row
+func AccrualKey(userID primitive.ObjectID, windowStart time.Time) string {
+	return fmt.Sprintf("accrual:%s:%d", userID.Hex(), windowStart.UnixMilli())
 }
 
-func (db *Database) CreateUserWallet(userID primitive.ObjectID) (*models.UserWallet, error) {
+// Movement describes a balance change and the ledger row recording it.
+// Amount is always positive; TransactionType gives the direction.
+type Movement struct {
+	UserID          primitive.ObjectID
+	Username        string
+	TransactionType int
+	TargetType      int
+	Amount          points.Points
+	IdempotencyKey  string
+	// Rate is recorded on accrual rows
+	Rate points.Points
+	// Boost and CampaignID are recorded on accrual rows earned during a campaign
+	Boost      points.Points
+	CampaignID primitive.ObjectID
+	// SourceUserID and ReferralLevel are recorded on referral bonus rows
+	SourceUserID  primitive.ObjectID
+	ReferralLevel int
+	// Remark and CreateBy default to empty and "System"
+	Remark   string
+	CreateBy string
+}
+
+func (m Movement) delta() points.Points {
+	if m.TransactionType == models.TransactionTypeDebit {
+		return -m.Amount
+	}
+	return m.Amount
+}
+
+// transaction builds the ledger row for the movement given the balance after it
+func (m Movement) transaction(afterAmt points.Points) *models.TransactionMovement {
+	transaction := newTransaction(m.UserID, m.Username, m.TransactionType, m.TargetType, m.Amount, afterAmt-m.delta(), afterAmt)
+	transaction.IdempotencyKey = m.IdempotencyKey
+	transaction.Rate = m.Rate
+	transaction.Boost = m.Boost
+	transaction.CampaignID = m.CampaignID
+	transaction.SourceUserID = m.SourceUserID
+	transaction.ReferralLevel = m.ReferralLevel
+	transaction.Remark = m.Remark
+	if m.CreateBy != "" {
+		transaction.CreateBy = m.CreateBy
+	}
+	return transaction
+}
+
+func newTransaction(userID primitive.ObjectID, username string, transactionType, targetType int, amount, beforeAmt, afterAmt points.Points) *models.TransactionMovement {
+	return &models.TransactionMovement{
+		ID:              primitive.NewObjectID(),
+		UserID:          userID,
+		Username:        username,
+		TransactionType: transactionType,
+		TargetType:      targetType,
+		Amount:          amount,
+		BeforeAmt:       beforeAmt,
+		AfterAmt:        afterAmt,
+		Enable:          true,
+		CreateBy:        "System",
+		CreateDate:      time.Now(),
+		ModifiedBy:      "",
+		ModifiedDate:    time.Time{},
+	}
+}
+
+func (db *MongoStore) CreateUserWallet(userID primitive.ObjectID) (*models.UserWallet, error) {
 	wallet := models.UserWallet{
 		ID:           primitive.NewObjectID(),
 		UserID:       userID,
 		WalletType:   1,
 		WalletName:   "Point Wallet",
-		Balance:      intToDecimal128(0),
+		Balance:      points.Points(0).Decimal128(),
 		Enable:       true,
 		CreateBy:     "System",
 		CreateDate:   time.Now(),
@@ -166,140 +260,277 @@ func (db *Database) CreateUserWallet(userID primitive.ObjectID) (*models.UserWal
 		ModifiedDate: time.Now(),
 	}
 
-	if db.TestMode {
-		// Mock implementation for test mode
-		db.mockWallets[userID] = &wallet
-		log.Printf("➕ [TEST] Created new wallet for user %s", userID.Hex())
-		return &wallet, nil
-	}
-
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result, err := db.UserWalletCollection.InsertOne(ctx, wallet)
+	// Upsert so that two concurrent callers cannot create two point wallets
+	filter := bson.M{"UserID": userID, "WalletType": 1, "Enable": true}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var created models.UserWallet
+	err := db.UserWalletCollection.FindOneAndUpdate(ctx, filter, bson.M{"$setOnInsert": wallet}, opts).Decode(&created)
 	if err != nil {
 		return nil, err
 	}
 
-	wallet.ID = result.InsertedID.(primitive.ObjectID)
 	log.Printf("➕ Created new wallet for user %s", userID.Hex())
-	return &wallet, nil
+	return &created, nil
 }
 
-func (db *Database) UpdateWalletBalance(userID primitive.ObjectID, amount int) (*models.UserWallet, error) {
-	wallet, err := db.GetUserWallet(userID)
-	if err != nil {
-		return nil, err
+// incBalance atomically adds amount to the user's point wallet. Debits only
+// match when the current balance covers them, so the balance never goes negative.
+func (db *MongoStore) incBalance(ctx context.Context, userID primitive.ObjectID, amount points.Points) (*models.UserWallet, error) {
+	filter := bson.M{"UserID": userID, "WalletType": 1, "Enable": true}
+	if amount < 0 {
+		filter["Balance"] = bson.M{"$gte": (-amount).Decimal128()}
 	}
 
-	current := decimal128ToInt(wallet.Balance)
-	newBalance := current + amount
-	if newBalance < 0 {
-		return nil, fmt.Errorf("insufficient balance")
+	update := bson.M{
+		"$inc": bson.M{"Balance": amount.Decimal128()},
+		"$set": bson.M{
+			"ModifiedBy":   "API",
+			"ModifiedDate": time.Now(),
+		},
 	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
-	wallet.Balance = intToDecimal128(newBalance)
-	wallet.ModifiedBy = "API"
-	wallet.ModifiedDate = time.Now()
+	var wallet models.UserWallet
+	err := db.UserWalletCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&wallet)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInsufficientBalance
+		}
+		return nil, err
+	}
+	return &wallet, nil
+}
 
-	if db.TestMode {
-		db.mockWallets[userID] = wallet
-		log.Printf("💵 [TEST] Updated wallet balance for user %s: %+d → %+d",
-			userID.Hex(), current, newBalance)
-		return wallet, nil
+func (db *MongoStore) UpdateWalletBalance(userID primitive.ObjectID, amount points.Points) (*models.UserWallet, error) {
+	// Make sure the wallet exists before the conditional update
+	if _, err := db.GetUserWallet(userID); err != nil {
+		return nil, err
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	update := bson.M{
-		"$set": bson.M{
-			"Balance":      wallet.Balance,
-			"ModifiedBy":   wallet.ModifiedBy,
-			"ModifiedDate": wallet.ModifiedDate,
-		},
+	wallet, err := db.incBalance(ctx, userID, amount)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err = db.UserWalletCollection.UpdateOne(ctx, bson.M{"_id": wallet.ID}, update)
+	newBalance, err := BalanceOf(wallet)
 	if err != nil {
 		return nil, err
 	}
-
-	log.Printf("💵 Updated wallet balance for user %s: %+d → %+d",
-		userID.Hex(), current, newBalance)
+	log.Printf("💵 Updated wallet balance for user %s: %s → %s",
+		userID.Hex(), newBalance-amount, newBalance)
 
 	return wallet, nil
 }
 
-func (db *Database) CreateTransaction(userID primitive.ObjectID, username string, transactionType, targetType, amount, beforeAmt, afterAmt int) error {
-	transaction := models.TransactionMovement{
-		ID:              primitive.NewObjectID(),
-		UserID:          userID,
-		Username:        username,
-		TransactionType: transactionType,
-		TargetType:      targetType,
-		Amount:          amount,
-		BeforeAmt:       beforeAmt,
-		AfterAmt:        afterAmt,
-		Enable:          true,
-		CreateBy:        "System",
-		CreateDate:      time.Now(),
-		ModifiedBy:      "",
-		ModifiedDate:    time.Time{},
+func (db *MongoStore) insertTransaction(ctx context.Context, transaction *models.TransactionMovement) error {
+	_, err := db.TransactionCollection.InsertOne(ctx, transaction)
+	if err != nil {
+		log.Printf("❌ Failed to create transaction for user %s: %v", transaction.UserID.Hex(), err)
+		return err
 	}
 
-	if db.TestMode {
-		// Mock implementation for test mode
-		db.mockTransactions = append(db.mockTransactions, &transaction)
-		log.Printf("📊 [TEST] Created transaction for user %s (%s): Type: %d, Amount: %d, Before: %d, After: %d",
-			userID.Hex(), username, transactionType, amount, beforeAmt, afterAmt)
-		return nil
-	}
+	log.Printf("📊 Created transaction for user %s (%s): Type: %d, Amount: %s, Before: %s, After: %s",
+		transaction.UserID.Hex(), transaction.Username, transaction.TransactionType,
+		transaction.Amount, transaction.BeforeAmt, transaction.AfterAmt)
+	return nil
+}
 
+func (db *MongoStore) CreateTransaction(userID primitive.ObjectID, username string, transactionType, targetType int, amount, beforeAmt, afterAmt points.Points) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := db.TransactionCollection.InsertOne(ctx, transaction)
+	return db.insertTransaction(ctx, newTransaction(userID, username, transactionType, targetType, amount, beforeAmt, afterAmt))
+}
+
+// migrateWallet adds a balance delta built elsewhere (e.g. by the in-memory
+// store) and copies its ledger rows in one transaction. The rows were
+// recorded against a zero-based wallet and are rebased onto the existing
+// balance; their _id and idempotency keys are kept. If the rows are already
+// there the wallet was migrated by an earlier attempt and is left alone.
+func (db *MongoStore) migrateWallet(userID primitive.ObjectID, delta points.Points, transactions []models.TransactionMovement) (bool, error) {
+	// Wallet creation is an upsert and stays outside the transaction
+	if _, err := db.GetUserWallet(userID); err != nil {
+		return false, err
+	}
+
+	err := db.withTransaction(func(sessCtx mongo.SessionContext) error {
+		wallet, err := db.incBalance(sessCtx, userID, delta)
+		if err != nil {
+			return err
+		}
+		balance, err := BalanceOf(wallet)
+		if err != nil {
+			return err
+		}
+		base := balance - delta
+
+		for _, t := range transactions {
+			t.BeforeAmt += base
+			t.AfterAmt += base
+			if err := db.insertTransaction(sessCtx, &t); err != nil {
+				return err
+			}
+		}
+
+		// The rows keep their _id and may sort before the reconciliation
+		// checkpoint, so the next run walks the whole ledger again
+		_, err = db.CheckpointCollection.DeleteOne(sessCtx, bson.M{"_id": userID})
+		return err
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// withTransaction runs fn inside a multi-document transaction.
+// Requires MongoDB to run as a replica set (or sharded cluster).
+func (db *MongoStore) withTransaction(fn func(sessCtx mongo.SessionContext) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	session, err := db.Client.StartSession()
 	if err != nil {
-		log.Printf("❌ Failed to create transaction for user %s: %v", userID.Hex(), err)
 		return err
 	}
+	defer session.EndSession(ctx)
 
-	log.Printf("📊 Created transaction for user %s (%s): Type: %d, Amount: %d, Before: %d, After: %d",
-		userID.Hex(), username, transactionType, amount, beforeAmt, afterAmt)
-	return nil
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	return err
 }
 
-func (db *Database) AccruePoints(userID primitive.ObjectID, username string, points int) error {
-	wallet, err := db.GetUserWallet(userID)
+// applyMovement updates the balance and writes the matching ledger row.
+// It must run inside withTransaction so both writes commit together; a
+// duplicate idempotency key aborts the transaction and rolls back the $inc.
+func (db *MongoStore) applyMovement(sessCtx mongo.SessionContext, movement Movement) (*models.TransactionMovement, error) {
+	wallet, err := db.incBalance(sessCtx, movement.UserID, movement.delta())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	beforeAmt := decimal128ToInt(wallet.Balance)
+	balance, err := BalanceOf(wallet)
+	if err != nil {
+		return nil, err
+	}
+	transaction := movement.transaction(balance)
+	if err := db.insertTransaction(sessCtx, transaction); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrDuplicateTransaction
+		}
+		return nil, err
+	}
+	return transaction, nil
+}
 
-	_, err = db.UpdateWalletBalance(userID, points)
+func (db *MongoStore) AccruePoints(movement Movement, caps AccrualCaps, referrals []ReferralShare) (*AccrualOutcome, error) {
+	// Wallet creation is an upsert and stays outside the transaction
+	if _, err := db.GetUserWallet(movement.UserID); err != nil {
+		return nil, err
+	}
+	for _, share := range referrals {
+		if _, err := db.GetUserWallet(share.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	movement.TransactionType = models.TransactionTypeCredit
+	movement.TargetType = models.TargetTypePointAccrual
+
+	var transaction *models.TransactionMovement
+	var outcome *AccrualOutcome
+	err := db.withTransaction(func(sessCtx mongo.SessionContext) error {
+		// Concurrent accruals for the user write the same counters, so one
+		// of them hits a write conflict and is retried with fresh totals
+		allowance, err := db.accrualAllowance(sessCtx, movement.UserID, caps, time.Now())
+		if err != nil {
+			return err
+		}
+		var usage []CapUsage
+		outcome, usage, err = allowance.take(movement.Amount)
+		if err != nil {
+			return err
+		}
+
+		credit := movement
+		credit.Amount = outcome.Credited
+		transaction, err = db.applyMovement(sessCtx, credit)
+		if err != nil {
+			return err
+		}
+		for _, share := range referrals {
+			bonus := share.bonus(movement, outcome.Credited)
+			if bonus == nil {
+				continue
+			}
+			paid, err := db.applyMovement(sessCtx, *bonus)
+			if err != nil {
+				return err
+			}
+			outcome.Referrals = append(outcome.Referrals, paid)
+		}
+		return db.saveCounters(sessCtx, movement.UserID, usage)
+	})
+	if err == ErrDuplicateTransaction {
+		log.Printf("⏭️ Accrual %s already recorded for user %s, skipping", movement.IdempotencyKey, movement.UserID.Hex())
+		return nil, err
+	}
+	if err == ErrCapReached {
+		log.Printf("⛔ Accrual cap reached for user %s (%s), nothing credited", movement.Username, movement.UserID.Hex())
+		return nil, err
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	log.Printf("💰 Awarded %s points to user %s (%s) - Balance: %s",
+		outcome.Credited, movement.Username, movement.UserID.Hex(), transaction.AfterAmt)
+	return outcome, nil
+}
+
+// adjustmentMovement turns a signed admin adjustment into a Movement
+func adjustmentMovement(userID primitive.ObjectID, username string, amount points.Points, reason, operator, idempotencyKey string) Movement {
+	movement := Movement{
+		UserID:          userID,
+		Username:        username,
+		TransactionType: models.TransactionTypeCredit,
+		TargetType:      models.TargetTypeAdminAdjustment,
+		Amount:          amount,
+		IdempotencyKey:  idempotencyKey,
+		Remark:          reason,
+		CreateBy:        operator,
 	}
+	if amount < 0 {
+		movement.TransactionType = models.TransactionTypeDebit
+		movement.Amount = -amount
+	}
+	return movement
+}
 
-	afterAmt := beforeAmt + points
+func (db *MongoStore) AdjustBalance(userID primitive.ObjectID, username string, amount points.Points, reason, operator, idempotencyKey string) (*models.TransactionMovement, error) {
+	if _, err := db.GetUserWallet(userID); err != nil {
+		return nil, err
+	}
 
-	// Create transaction record (credit = 2, point accrual = 1)
-	if db.TestMode {
-		log.Printf("💰 [TEST] Awarded %d points to user %s (%s) - Balance: %d",
-			points, username, userID.Hex(), afterAmt)
-	} else {
-		log.Printf("💰 Awarded %d points to user %s (%s)", points, username, userID.Hex())
+	var transaction *models.TransactionMovement
+	err := db.withTransaction(func(sessCtx mongo.SessionContext) error {
+		var err error
+		transaction, err = db.applyMovement(sessCtx, adjustmentMovement(userID, username, amount, reason, operator, idempotencyKey))
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return db.CreateTransaction(
-		userID,
-		username,
-		2,
-		1,
-		points,
-		beforeAmt,
-		afterAmt,
-	)
 
+	log.Printf("🛠️ Adjusted wallet of user %s (%s) by %s by %s: %s - Balance: %s",
+		username, userID.Hex(), amount, operator, reason, transaction.AfterAmt)
+	return transaction, nil
 }
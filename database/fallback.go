@@ -0,0 +1,322 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go-ubipay-websocket/config"
+	"go-ubipay-websocket/models"
+	"go-ubipay-websocket/points"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ModeStrict   = "strict"
+	ModeFallback = "fallback"
+	ModeMemory   = "memory"
+)
+
+// Open returns the Store selected by cfg.DatabaseMode:
+//   - strict:   MongoDB only, an unreachable server is an error
+//   - fallback: MongoDB if reachable, otherwise the in-memory store until a reconnect succeeds
+//   - memory:   in-memory store only
+func Open(cfg *config.Config) (Store, error) {
+	switch cfg.DatabaseMode {
+	case ModeStrict:
+		return ConnectMongoDB(cfg)
+
+	case ModeMemory:
+		store := NewTestDatabase()
+		DB = store
+		return store, nil
+
+	case ModeFallback:
+		mongoStore, err := ConnectMongoDB(cfg)
+		if err == nil {
+			return mongoStore, nil
+		}
+		log.Printf("⚠️ MongoDB unavailable, falling back to in-memory store (retry every %v)", cfg.DBReconnectInterval)
+		store := NewFallbackStore(cfg)
+		DB = store
+		return store, nil
+
+	default:
+		return nil, fmt.Errorf("unknown DB_MODE %q (expected %s, %s or %s)", cfg.DatabaseMode, ModeStrict, ModeFallback, ModeMemory)
+	}
+}
+
+// FallbackStore serves requests from a MemoryStore while MongoDB is
+// unreachable. A background loop keeps retrying the connection; once it
+// succeeds the in-memory wallets and ledger are migrated into MongoDB and
+// all further calls go to the MongoStore.
+type FallbackStore struct {
+	cfg     *config.Config
+	mu      sync.RWMutex
+	current Store
+	memory  *MemoryStore
+	stop    chan struct{}
+	once    sync.Once
+}
+
+func NewFallbackStore(cfg *config.Config) *FallbackStore {
+	memory := NewTestDatabase()
+	s := &FallbackStore{
+		cfg:     cfg,
+		current: memory,
+		memory:  memory,
+		stop:    make(chan struct{}),
+	}
+	go s.reconnectLoop()
+	return s
+}
+
+func (s *FallbackStore) reconnectLoop() {
+	ticker := time.NewTicker(s.cfg.DBReconnectInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			mongoStore, err := ConnectMongoDB(s.cfg)
+			if err != nil {
+				continue
+			}
+			if err := s.migrate(mongoStore); err != nil {
+				log.Printf("❌ Failed to migrate in-memory data to MongoDB, staying in memory mode: %v", err)
+				mongoStore.Disconnect()
+				continue
+			}
+			return
+		}
+	}
+}
+
+// migrate copies every in-memory wallet delta and ledger row into MongoDB and
+// switches the active backend. Callers are blocked for the duration.
+func (s *FallbackStore) migrate(mongoStore *MongoStore) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.memory.mu.RLock()
+	wallets := make([]models.UserWallet, 0, len(s.memory.wallets))
+	for _, wallet := range s.memory.wallets {
+		wallets = append(wallets, *wallet)
+	}
+	transactions := make(map[primitive.ObjectID][]models.TransactionMovement)
+	for _, transaction := range s.memory.transactions {
+		transactions[transaction.UserID] = append(transactions[transaction.UserID], *transaction)
+	}
+	audit := make([]models.AdminAuditLog, 0, len(s.memory.audit))
+	for _, entry := range s.memory.audit {
+		audit = append(audit, *entry)
+	}
+	s.memory.mu.RUnlock()
+
+	// Each wallet moves with its ledger rows in one transaction, so a failed
+	// migration can be retried without crediting the delta twice
+	migrated := 0
+	for _, wallet := range wallets {
+		delta, err := BalanceOf(&wallet)
+		if err != nil {
+			return err
+		}
+		rows := transactions[wallet.UserID]
+		if delta == 0 && len(rows) == 0 {
+			continue
+		}
+
+		done, err := mongoStore.migrateWallet(wallet.UserID, delta, rows)
+		if err != nil {
+			return fmt.Errorf("wallet %s: %w", wallet.UserID.Hex(), err)
+		}
+		if done {
+			migrated++
+		} else {
+			log.Printf("⏭️ Wallet %s was already migrated, skipping", wallet.UserID.Hex())
+		}
+	}
+
+	for _, entry := range audit {
+		if err := mongoStore.InsertAdminAudit(&entry); err != nil {
+			return fmt.Errorf("admin audit entry %s: %w", entry.ID.Hex(), err)
+		}
+	}
+
+	s.current = mongoStore
+	DB = mongoStore
+	log.Printf("✅ Migrated %d in-memory wallets to MongoDB, fallback mode ended", migrated)
+	return nil
+}
+
+func (s *FallbackStore) store() Store {
+	return s.current
+}
+
+func (s *FallbackStore) Disconnect() error {
+	s.once.Do(func() { close(s.stop) })
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().Disconnect()
+}
+
+func (s *FallbackStore) GetUserBySessionToken(sessionToken string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().GetUserBySessionToken(sessionToken)
+}
+
+func (s *FallbackStore) GetUserByUsername(username string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().GetUserByUsername(username)
+}
+
+func (s *FallbackStore) GetUserByID(userID primitive.ObjectID) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().GetUserByID(userID)
+}
+
+// WatchUsers streams changes once the fallback store has switched to MongoDB
+func (s *FallbackStore) WatchUsers(ctx context.Context, onChange func(userID primitive.ObjectID)) error {
+	s.mu.RLock()
+	watcher, ok := s.store().(UserWatcher)
+	s.mu.RUnlock()
+	if !ok {
+		return ErrWatchUnsupported
+	}
+	return watcher.WatchUsers(ctx, onChange)
+}
+
+func (s *FallbackStore) ListAccrualRates() ([]models.AccrualRate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().ListAccrualRates()
+}
+
+// Campaigns created while in memory mode are not migrated; recreate them
+// once MongoDB is back.
+
+func (s *FallbackStore) ListCampaigns(endedAfter time.Time) ([]models.Campaign, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().ListCampaigns(endedAfter)
+}
+
+func (s *FallbackStore) InsertCampaign(campaign *models.Campaign) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().InsertCampaign(campaign)
+}
+
+func (s *FallbackStore) DisableCampaign(campaignID primitive.ObjectID) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().DisableCampaign(campaignID)
+}
+
+func (s *FallbackStore) GetUserWallet(userID primitive.ObjectID) (*models.UserWallet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().GetUserWallet(userID)
+}
+
+func (s *FallbackStore) CreateUserWallet(userID primitive.ObjectID) (*models.UserWallet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().CreateUserWallet(userID)
+}
+
+func (s *FallbackStore) UpdateWalletBalance(userID primitive.ObjectID, amount points.Points) (*models.UserWallet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().UpdateWalletBalance(userID, amount)
+}
+
+func (s *FallbackStore) CreateTransaction(userID primitive.ObjectID, username string, transactionType, targetType int, amount, beforeAmt, afterAmt points.Points) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().CreateTransaction(userID, username, transactionType, targetType, amount, beforeAmt, afterAmt)
+}
+
+func (s *FallbackStore) AccruePoints(movement Movement, caps AccrualCaps, referrals []ReferralShare) (*AccrualOutcome, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().AccruePoints(movement, caps, referrals)
+}
+
+func (s *FallbackStore) AccrualAllowance(userID primitive.ObjectID, caps AccrualCaps) (*Allowance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().AccrualAllowance(userID, caps)
+}
+
+func (s *FallbackStore) ReferralSummary(referrerID primitive.ObjectID) (*ReferralSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().ReferralSummary(referrerID)
+}
+
+func (s *FallbackStore) AdjustBalance(userID primitive.ObjectID, username string, amount points.Points, reason, operator, idempotencyKey string) (*models.TransactionMovement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().AdjustBalance(userID, username, amount, reason, operator, idempotencyKey)
+}
+
+func (s *FallbackStore) ListTransactions(query HistoryQuery) (*HistoryPage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().ListTransactions(query)
+}
+
+// Reconciliation findings are not migrated out of memory mode; the next run
+// against MongoDB reports whatever still applies.
+
+func (s *FallbackStore) ListWallets() ([]models.UserWallet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().ListWallets()
+}
+
+func (s *FallbackStore) InsertLedgerEntry(movement Movement, afterAmt points.Points) (*models.TransactionMovement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().InsertLedgerEntry(movement, afterAmt)
+}
+
+func (s *FallbackStore) RecordDiscrepancy(discrepancy *models.LedgerDiscrepancy) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().RecordDiscrepancy(discrepancy)
+}
+
+func (s *FallbackStore) ListDiscrepancies(limit int) ([]models.LedgerDiscrepancy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().ListDiscrepancies(limit)
+}
+
+func (s *FallbackStore) ReconcileCheckpoint(userID primitive.ObjectID) (*models.ReconcileCheckpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().ReconcileCheckpoint(userID)
+}
+
+func (s *FallbackStore) SaveReconcileCheckpoint(checkpoint *models.ReconcileCheckpoint) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().SaveReconcileCheckpoint(checkpoint)
+}
+
+func (s *FallbackStore) InsertAdminAudit(entry *models.AdminAuditLog) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store().InsertAdminAudit(entry)
+}
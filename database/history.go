@@ -0,0 +1,118 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"go-ubipay-websocket/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// HistoryQuery filters a user's ledger. Zero values mean "no filter";
+// Before is the cursor, only rows with a smaller _id are returned; After
+// likewise keeps only rows with a larger _id.
+type HistoryQuery struct {
+	UserID          primitive.ObjectID
+	From            time.Time
+	To              time.Time
+	TransactionType int
+	TargetType      int
+	Before          primitive.ObjectID
+	After           primitive.ObjectID
+	Limit           int
+}
+
+// HistoryPage is one page of ledger rows. NextCursor is the _id to pass as
+// Before for the next page, zero when there are no more rows.
+type HistoryPage struct {
+	Transactions []models.TransactionMovement
+	NextCursor   primitive.ObjectID
+}
+
+// matches is the in-memory counterpart of filter
+func (q HistoryQuery) matches(t *models.TransactionMovement) bool {
+	switch {
+	case t.UserID != q.UserID:
+		return false
+	case !q.From.IsZero() && t.CreateDate.Before(q.From):
+		return false
+	case !q.To.IsZero() && !t.CreateDate.Before(q.To):
+		return false
+	case q.TransactionType != 0 && t.TransactionType != q.TransactionType:
+		return false
+	case q.TargetType != 0 && t.TargetType != q.TargetType:
+		return false
+	case !q.Before.IsZero() && bytes.Compare(t.ID[:], q.Before[:]) >= 0:
+		return false
+	case !q.After.IsZero() && bytes.Compare(t.ID[:], q.After[:]) <= 0:
+		return false
+	}
+	return true
+}
+
+func (q HistoryQuery) filter() bson.M {
+	filter := bson.M{"UserID": q.UserID}
+
+	date := bson.M{}
+	if !q.From.IsZero() {
+		date["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		date["$lt"] = q.To
+	}
+	if len(date) > 0 {
+		filter["CreateDate"] = date
+	}
+
+	if q.TransactionType != 0 {
+		filter["TransactionType"] = q.TransactionType
+	}
+	if q.TargetType != 0 {
+		filter["TargetType"] = q.TargetType
+	}
+	id := bson.M{}
+	if !q.Before.IsZero() {
+		id["$lt"] = q.Before
+	}
+	if !q.After.IsZero() {
+		id["$gt"] = q.After
+	}
+	if len(id) > 0 {
+		filter["_id"] = id
+	}
+	return filter
+}
+
+// page trims rows fetched with Limit+1 to Limit and sets the cursor
+func (q HistoryQuery) page(rows []models.TransactionMovement) *HistoryPage {
+	page := &HistoryPage{Transactions: rows}
+	if len(rows) > q.Limit {
+		page.Transactions = rows[:q.Limit]
+		page.NextCursor = rows[q.Limit-1].ID
+	}
+	return page
+}
+
+func (db *MongoStore) ListTransactions(query HistoryQuery) (*HistoryPage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetLimit(int64(query.Limit + 1))
+
+	cursor, err := db.TransactionCollection.Find(ctx, query.filter(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]models.TransactionMovement, 0, query.Limit+1)
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	return query.page(rows), nil
+}
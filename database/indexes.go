@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureIndexes creates the indexes the application relies on. It is safe
+// to call on every startup; existing indexes are left untouched.
+func (db *MongoStore) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Only ledger rows that carry a key take part in the uniqueness check,
+	// so historical rows without one do not collide.
+	_, err := db.TransactionCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "IdempotencyKey", Value: 1}},
+		Options: options.Index().
+			SetName("IdempotencyKey_unique").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"IdempotencyKey": bson.M{"$type": "string"}}),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Transaction history: newest first per user, paginated on _id
+	_, err = db.TransactionCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "UserID", Value: 1}, {Key: "_id", Value: -1}},
+		Options: options.Index().SetName("UserID_id"),
+	})
+	if err != nil {
+		return err
+	}
+
+	// One document per reconciliation finding
+	_, err = db.DiscrepancyCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "UserID", Value: 1},
+			{Key: "Kind", Value: 1},
+			{Key: "TransactionID", Value: 1},
+			{Key: "Expected", Value: 1},
+			{Key: "Actual", Value: 1},
+		},
+		Options: options.Index().SetName("Discrepancy_unique").SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	// One accrual counter per user and cap window; ended windows expire
+	_, err = db.CounterCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "UserID", Value: 1}, {Key: "Period", Value: 1}},
+			Options: options.Index().SetName("UserID_Period_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "ExpiresAt", Value: 1}},
+			Options: options.Index().SetName("ExpiresAt_ttl").SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Println("✅ MongoDB indexes ensured")
+	return nil
+}
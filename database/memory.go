@@ -0,0 +1,498 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"go-ubipay-websocket/models"
+	"go-ubipay-websocket/points"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore is an in-memory implementation of Store used for local
+// development and tests when MongoDB is not available
+type MemoryStore struct {
+	mu            sync.RWMutex
+	users         map[primitive.ObjectID]*models.User
+	wallets       map[primitive.ObjectID]*models.UserWallet
+	transactions  []*models.TransactionMovement
+	keys          map[string]bool
+	audit         []*models.AdminAuditLog
+	discrepancies []*models.LedgerDiscrepancy
+	rates         []models.AccrualRate
+	campaigns     []*models.Campaign
+	checkpoints   map[primitive.ObjectID]models.ReconcileCheckpoint
+}
+
+// NewTestDatabase creates a mock database for testing without MongoDB
+func NewTestDatabase() *MemoryStore {
+	log.Println("🔧 Using test database (MongoDB not available)")
+	return &MemoryStore{
+		users:        make(map[primitive.ObjectID]*models.User),
+		wallets:      make(map[primitive.ObjectID]*models.UserWallet),
+		transactions: make([]*models.TransactionMovement, 0),
+		keys:         make(map[string]bool),
+		checkpoints:  make(map[primitive.ObjectID]models.ReconcileCheckpoint),
+	}
+}
+
+func (db *MemoryStore) Disconnect() error {
+	return nil
+}
+
+// AddUser registers a user so it can be found by GetUserBySessionToken
+func (db *MemoryStore) AddUser(user *models.User) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	u := *user
+	db.users[u.ID] = &u
+}
+
+// SetAccrualRates replaces the rate table returned by ListAccrualRates
+func (db *MemoryStore) SetAccrualRates(rates []models.AccrualRate) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.rates = append([]models.AccrualRate(nil), rates...)
+}
+
+func (db *MemoryStore) ListAccrualRates() ([]models.AccrualRate, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return append([]models.AccrualRate(nil), db.rates...), nil
+}
+
+func (db *MemoryStore) ListCampaigns(endedAfter time.Time) ([]models.Campaign, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	campaigns := make([]models.Campaign, 0, len(db.campaigns))
+	for _, campaign := range db.campaigns {
+		if endedAfter.IsZero() || campaign.EndAt.After(endedAfter) {
+			campaigns = append(campaigns, *campaign)
+		}
+	}
+	sort.Slice(campaigns, func(i, j int) bool {
+		return campaigns[i].StartAt.Before(campaigns[j].StartAt)
+	})
+	return campaigns, nil
+}
+
+func (db *MemoryStore) InsertCampaign(campaign *models.Campaign) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if campaign.ID.IsZero() {
+		campaign.ID = primitive.NewObjectID()
+	}
+	c := *campaign
+	db.campaigns = append(db.campaigns, &c)
+	log.Printf("🎉 [TEST] Created campaign %q (%sx) by %s", campaign.Name, campaign.Multiplier, campaign.CreateBy)
+	return nil
+}
+
+func (db *MemoryStore) DisableCampaign(campaignID primitive.ObjectID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, campaign := range db.campaigns {
+		if campaign.ID == campaignID {
+			campaign.Enable = false
+			return nil
+		}
+	}
+	return ErrCampaignNotFound
+}
+
+func (db *MemoryStore) GetUserBySessionToken(sessionToken string) (*models.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, user := range db.users {
+		if user.SessionToken == sessionToken {
+			u := *user
+			return &u, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (db *MemoryStore) GetUserByUsername(username string) (*models.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, user := range db.users {
+		if user.Username == username {
+			u := *user
+			return &u, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (db *MemoryStore) GetUserByID(userID primitive.ObjectID) (*models.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	user, exists := db.users[userID]
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+	u := *user
+	return &u, nil
+}
+
+func (db *MemoryStore) GetUserWallet(userID primitive.ObjectID) (*models.UserWallet, error) {
+	db.mu.RLock()
+	wallet, exists := db.wallets[userID]
+	db.mu.RUnlock()
+
+	if exists {
+		log.Printf("🔍 [TEST] Retrieved wallet for user %s - Balance: %s", userID.Hex(), wallet.Balance)
+		w := *wallet
+		return &w, nil
+	}
+	// Create a new wallet if it doesn't exist
+	return db.CreateUserWallet(userID)
+}
+
+func (db *MemoryStore) CreateUserWallet(userID primitive.ObjectID) (*models.UserWallet, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if wallet, exists := db.wallets[userID]; exists {
+		w := *wallet
+		return &w, nil
+	}
+
+	wallet := models.UserWallet{
+		ID:           primitive.NewObjectID(),
+		UserID:       userID,
+		WalletType:   1,
+		WalletName:   "Point Wallet",
+		Balance:      points.Points(0).Decimal128(),
+		Enable:       true,
+		CreateBy:     "System",
+		CreateDate:   time.Now(),
+		ModifiedBy:   "System",
+		ModifiedDate: time.Now(),
+	}
+	db.wallets[userID] = &wallet
+
+	log.Printf("➕ [TEST] Created new wallet for user %s", userID.Hex())
+	w := wallet
+	return &w, nil
+}
+
+// updateBalanceLocked applies amount to the wallet; db.mu must be held
+func (db *MemoryStore) updateBalanceLocked(userID primitive.ObjectID, amount points.Points) (*models.UserWallet, error) {
+	wallet, exists := db.wallets[userID]
+	if !exists {
+		return nil, fmt.Errorf("wallet not found for user %s", userID.Hex())
+	}
+
+	current, err := BalanceOf(wallet)
+	if err != nil {
+		return nil, err
+	}
+	newBalance := current + amount
+	if newBalance < 0 {
+		return nil, ErrInsufficientBalance
+	}
+
+	wallet.Balance = newBalance.Decimal128()
+	wallet.ModifiedBy = "API"
+	wallet.ModifiedDate = time.Now()
+
+	log.Printf("💵 [TEST] Updated wallet balance for user %s: %s → %s",
+		userID.Hex(), current, newBalance)
+	w := *wallet
+	return &w, nil
+}
+
+func (db *MemoryStore) UpdateWalletBalance(userID primitive.ObjectID, amount points.Points) (*models.UserWallet, error) {
+	if _, err := db.GetUserWallet(userID); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.updateBalanceLocked(userID, amount)
+}
+
+func (db *MemoryStore) insertTransactionLocked(transaction *models.TransactionMovement) {
+	if transaction.IdempotencyKey != "" {
+		db.keys[transaction.IdempotencyKey] = true
+	}
+	db.transactions = append(db.transactions, transaction)
+	log.Printf("📊 [TEST] Created transaction for user %s (%s): Type: %d, Amount: %s, Before: %s, After: %s",
+		transaction.UserID.Hex(), transaction.Username, transaction.TransactionType,
+		transaction.Amount, transaction.BeforeAmt, transaction.AfterAmt)
+}
+
+func (db *MemoryStore) CreateTransaction(userID primitive.ObjectID, username string, transactionType, targetType int, amount, beforeAmt, afterAmt points.Points) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.insertTransactionLocked(newTransaction(userID, username, transactionType, targetType, amount, beforeAmt, afterAmt))
+	return nil
+}
+
+// applyMovementLocked is the in-memory counterpart of MongoStore.applyMovement:
+// the balance change and ledger row happen under the same lock.
+func (db *MemoryStore) applyMovementLocked(movement Movement) (*models.TransactionMovement, error) {
+	if movement.IdempotencyKey != "" && db.keys[movement.IdempotencyKey] {
+		return nil, ErrDuplicateTransaction
+	}
+
+	wallet, err := db.updateBalanceLocked(movement.UserID, movement.delta())
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := BalanceOf(wallet)
+	if err != nil {
+		return nil, err
+	}
+	transaction := movement.transaction(balance)
+	db.insertTransactionLocked(transaction)
+	return transaction, nil
+}
+
+// accrualAllowanceLocked sums the user's accrual rows per cap window; db.mu must be held
+func (db *MemoryStore) accrualAllowanceLocked(userID primitive.ObjectID, caps AccrualCaps, now time.Time) *Allowance {
+	usage := caps.windows(now)
+	for i := range usage {
+		var used points.Points
+		for _, t := range db.transactions {
+			if t.UserID == userID && isAccrual(t) && !t.CreateDate.Before(usage[i].start) {
+				used += t.Amount
+			}
+		}
+		usage[i].setUsed(used)
+	}
+	return newAllowance(usage)
+}
+
+func (db *MemoryStore) AccruePoints(movement Movement, caps AccrualCaps, referrals []ReferralShare) (*AccrualOutcome, error) {
+	if _, err := db.GetUserWallet(movement.UserID); err != nil {
+		return nil, err
+	}
+	for _, share := range referrals {
+		if _, err := db.GetUserWallet(share.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if movement.IdempotencyKey != "" && db.keys[movement.IdempotencyKey] {
+		log.Printf("⏭️ [TEST] Accrual %s already recorded for user %s, skipping", movement.IdempotencyKey, movement.UserID.Hex())
+		return nil, ErrDuplicateTransaction
+	}
+	outcome, _, err := db.accrualAllowanceLocked(movement.UserID, caps, time.Now()).take(movement.Amount)
+	if err == ErrCapReached {
+		log.Printf("⛔ [TEST] Accrual cap reached for user %s (%s), nothing credited", movement.Username, movement.UserID.Hex())
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	movement.TransactionType = models.TransactionTypeCredit
+	movement.TargetType = models.TargetTypePointAccrual
+	movement.Amount = outcome.Credited
+	transaction, err := db.applyMovementLocked(movement)
+	if err != nil {
+		return nil, err
+	}
+	for _, share := range referrals {
+		bonus := share.bonus(movement, outcome.Credited)
+		if bonus == nil {
+			continue
+		}
+		paid, err := db.applyMovementLocked(*bonus)
+		if err != nil {
+			return nil, err
+		}
+		t := *paid
+		outcome.Referrals = append(outcome.Referrals, &t)
+	}
+
+	log.Printf("💰 [TEST] Awarded %s points to user %s (%s) - Balance: %s",
+		outcome.Credited, movement.Username, movement.UserID.Hex(), transaction.AfterAmt)
+	return outcome, nil
+}
+
+func (db *MemoryStore) AccrualAllowance(userID primitive.ObjectID, caps AccrualCaps) (*Allowance, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.accrualAllowanceLocked(userID, caps, time.Now()), nil
+}
+
+func (db *MemoryStore) AdjustBalance(userID primitive.ObjectID, username string, amount points.Points, reason, operator, idempotencyKey string) (*models.TransactionMovement, error) {
+	if _, err := db.GetUserWallet(userID); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	transaction, err := db.applyMovementLocked(adjustmentMovement(userID, username, amount, reason, operator, idempotencyKey))
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("🛠️ [TEST] Adjusted wallet of user %s (%s) by %s by %s: %s - Balance: %s",
+		username, userID.Hex(), amount, operator, reason, transaction.AfterAmt)
+	t := *transaction
+	return &t, nil
+}
+
+func (db *MemoryStore) ListTransactions(query HistoryQuery) (*HistoryPage, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// Rows are appended in creation order, so walk backwards for newest first
+	rows := make([]models.TransactionMovement, 0, query.Limit+1)
+	for i := len(db.transactions) - 1; i >= 0 && len(rows) <= query.Limit; i-- {
+		if query.matches(db.transactions[i]) {
+			rows = append(rows, *db.transactions[i])
+		}
+	}
+	return query.page(rows), nil
+}
+
+func (db *MemoryStore) ReferralSummary(referrerID primitive.ObjectID) (*ReferralSummary, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	type key struct {
+		userID primitive.ObjectID
+		level  int
+	}
+	index := make(map[key]int)
+	referred := make([]ReferredUser, 0)
+	for _, t := range db.transactions {
+		if t.UserID != referrerID || t.TargetType != models.TargetTypeReferralBonus {
+			continue
+		}
+		k := key{t.SourceUserID, t.ReferralLevel}
+		i, exists := index[k]
+		if !exists {
+			i = len(referred)
+			index[k] = i
+			referred = append(referred, ReferredUser{UserID: t.SourceUserID, Level: t.ReferralLevel})
+		}
+		referred[i].Total += t.Amount
+		referred[i].Entries++
+		if t.CreateDate.After(referred[i].LastEarned) {
+			referred[i].LastEarned = t.CreateDate
+		}
+	}
+	return newReferralSummary(referrerID, referred), nil
+}
+
+func (db *MemoryStore) ListWallets() ([]models.UserWallet, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	wallets := make([]models.UserWallet, 0, len(db.wallets))
+	for _, wallet := range db.wallets {
+		wallets = append(wallets, *wallet)
+	}
+	return wallets, nil
+}
+
+func (db *MemoryStore) InsertLedgerEntry(movement Movement, afterAmt points.Points) (*models.TransactionMovement, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if movement.IdempotencyKey != "" && db.keys[movement.IdempotencyKey] {
+		return nil, ErrDuplicateTransaction
+	}
+	transaction := movement.transaction(afterAmt)
+	db.insertTransactionLocked(transaction)
+	t := *transaction
+	return &t, nil
+}
+
+func (db *MemoryStore) RecordDiscrepancy(discrepancy *models.LedgerDiscrepancy) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, existing := range db.discrepancies {
+		if existing.UserID == discrepancy.UserID && existing.Kind == discrepancy.Kind &&
+			existing.TransactionID == discrepancy.TransactionID &&
+			existing.Expected == discrepancy.Expected && existing.Actual == discrepancy.Actual {
+			existing.RunID = discrepancy.RunID
+			existing.LastSeen = discrepancy.LastSeen
+			if !discrepancy.CorrectionID.IsZero() {
+				existing.CorrectionID = discrepancy.CorrectionID
+			}
+			return nil
+		}
+	}
+
+	d := *discrepancy
+	d.ID = primitive.NewObjectID()
+	db.discrepancies = append(db.discrepancies, &d)
+	return nil
+}
+
+func (db *MemoryStore) ListDiscrepancies(limit int) ([]models.LedgerDiscrepancy, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	discrepancies := make([]models.LedgerDiscrepancy, 0, len(db.discrepancies))
+	for _, d := range db.discrepancies {
+		discrepancies = append(discrepancies, *d)
+	}
+	sort.Slice(discrepancies, func(i, j int) bool {
+		return discrepancies[i].LastSeen.After(discrepancies[j].LastSeen)
+	})
+	if len(discrepancies) > limit {
+		discrepancies = discrepancies[:limit]
+	}
+	return discrepancies, nil
+}
+
+func (db *MemoryStore) ReconcileCheckpoint(userID primitive.ObjectID) (*models.ReconcileCheckpoint, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	checkpoint, exists := db.checkpoints[userID]
+	if !exists {
+		return nil, nil
+	}
+	return &checkpoint, nil
+}
+
+func (db *MemoryStore) SaveReconcileCheckpoint(checkpoint *models.ReconcileCheckpoint) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.checkpoints[checkpoint.UserID] = *checkpoint
+	return nil
+}
+
+func (db *MemoryStore) InsertAdminAudit(entry *models.AdminAuditLog) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if entry.ID.IsZero() {
+		entry.ID = primitive.NewObjectID()
+	}
+	e := *entry
+	db.audit = append(db.audit, &e)
+	log.Printf("📝 [TEST] Admin audit: %s %s by %q -> %d", entry.HTTPMethod, entry.Path, entry.Actor, entry.Status)
+	return nil
+}
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go-ubipay-websocket/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func (db *MongoStore) ListAccrualRates() ([]models.AccrualRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := db.RateCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	rates := make([]models.AccrualRate, 0)
+	if err := cursor.All(ctx, &rates); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
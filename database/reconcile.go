@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go-ubipay-websocket/models"
+	"go-ubipay-websocket/points"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// discrepancyFilter identifies a finding across reconciliation runs
+func discrepancyFilter(d *models.LedgerDiscrepancy) bson.M {
+	return bson.M{
+		"UserID":        d.UserID,
+		"Kind":          d.Kind,
+		"TransactionID": d.TransactionID,
+		"Expected":      d.Expected,
+		"Actual":        d.Actual,
+	}
+}
+
+func (db *MongoStore) ListWallets() ([]models.UserWallet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := db.UserWalletCollection.Find(ctx, bson.M{"WalletType": 1, "Enable": true})
+	if err != nil {
+		return nil, err
+	}
+
+	wallets := make([]models.UserWallet, 0)
+	if err := cursor.All(ctx, &wallets); err != nil {
+		return nil, err
+	}
+	return wallets, nil
+}
+
+func (db *MongoStore) InsertLedgerEntry(movement Movement, afterAmt points.Points) (*models.TransactionMovement, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	transaction := movement.transaction(afterAmt)
+	if err := db.insertTransaction(ctx, transaction); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrDuplicateTransaction
+		}
+		return nil, err
+	}
+	return transaction, nil
+}
+
+func (db *MongoStore) RecordDiscrepancy(discrepancy *models.LedgerDiscrepancy) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	set := bson.M{"RunID": discrepancy.RunID, "LastSeen": discrepancy.LastSeen}
+	if !discrepancy.CorrectionID.IsZero() {
+		set["CorrectionID"] = discrepancy.CorrectionID
+	}
+	update := bson.M{
+		"$set":         set,
+		"$setOnInsert": bson.M{"FirstSeen": discrepancy.FirstSeen},
+	}
+
+	_, err := db.DiscrepancyCollection.UpdateOne(ctx, discrepancyFilter(discrepancy), update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (db *MongoStore) ReconcileCheckpoint(userID primitive.ObjectID) (*models.ReconcileCheckpoint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var checkpoint models.ReconcileCheckpoint
+	err := db.CheckpointCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&checkpoint)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+func (db *MongoStore) SaveReconcileCheckpoint(checkpoint *models.ReconcileCheckpoint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := db.CheckpointCollection.ReplaceOne(ctx, bson.M{"_id": checkpoint.UserID}, checkpoint, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (db *MongoStore) ListDiscrepancies(limit int) ([]models.LedgerDiscrepancy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "LastSeen", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := db.DiscrepancyCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	discrepancies := make([]models.LedgerDiscrepancy, 0)
+	if err := cursor.All(ctx, &discrepancies); err != nil {
+		return nil, err
+	}
+	return discrepancies, nil
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"go-ubipay-websocket/models"
+	"go-ubipay-websocket/points"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ReferralShare is a referrer's cut of an accrual. AccruePoints pays it in
+// the same transaction as the accrual, so a bonus is never lost to a failure
+// after the accrual's idempotency key was used.
+type ReferralShare struct {
+	UserID   primitive.ObjectID
+	Username string
+	Level    int
+	// Percent of the credited accrual
+	Percent points.Points
+}
+
+// bonus returns the movement paying the share of an accrual credit, nil when
+// it rounds down to nothing. Its key is derived from the accrual's.
+func (s ReferralShare) bonus(accrual Movement, credited points.Points) *Movement {
+	amount := new(big.Rat).Mul(credited.Rat(), s.Percent.Rat())
+	bonus := points.Truncate(amount.Quo(amount, big.NewRat(100, 1)))
+	if bonus <= 0 {
+		return nil
+	}
+	level := strconv.Itoa(s.Level)
+	return &Movement{
+		UserID:          s.UserID,
+		Username:        s.Username,
+		TransactionType: models.TransactionTypeCredit,
+		TargetType:      models.TargetTypeReferralBonus,
+		Amount:          bonus,
+		IdempotencyKey:  accrual.IdempotencyKey + ":referral:" + level,
+		Remark:          "Level " + level + " referral bonus from " + accrual.Username,
+		SourceUserID:    accrual.UserID,
+		ReferralLevel:   s.Level,
+	}
+}
+
+// ReferredUser is what a referrer earned from one referred user at one level
+type ReferredUser struct {
+	UserID     primitive.ObjectID `bson:"SourceUserID" json:"user_id"`
+	Level      int                `bson:"ReferralLevel" json:"level"`
+	Total      points.Points      `bson:"Total" json:"total"`
+	Entries    int                `bson:"Entries" json:"entries"`
+	LastEarned time.Time          `bson:"LastEarned" json:"last_earned"`
+}
+
+// ReferralSummary totals a referrer's bonus ledger rows. Levels[i] is the
+// total earned from users i+1 levels down; Referred is sorted by total,
+// highest first.
+type ReferralSummary struct {
+	ReferrerID primitive.ObjectID `json:"referrer_id"`
+	Total      points.Points      `json:"total"`
+	Levels     []points.Points    `json:"levels"`
+	Referred   []ReferredUser     `json:"referred"`
+}
+
+func newReferralSummary(referrerID primitive.ObjectID, referred []ReferredUser) *ReferralSummary {
+	summary := &ReferralSummary{
+		ReferrerID: referrerID,
+		Levels:     make([]points.Points, 0),
+		Referred:   referred,
+	}
+	for _, r := range referred {
+		summary.Total += r.Total
+		for len(summary.Levels) < r.Level {
+			summary.Levels = append(summary.Levels, 0)
+		}
+		if r.Level > 0 {
+			summary.Levels[r.Level-1] += r.Total
+		}
+	}
+	sort.Slice(referred, func(i, j int) bool {
+		return referred[i].Total > referred[j].Total
+	})
+	return summary
+}
+
+func (db *MongoStore) ReferralSummary(referrerID primitive.ObjectID) (*ReferralSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := db.TransactionCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"UserID": referrerID, "TargetType": models.TargetTypeReferralBonus}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        bson.M{"SourceUserID": "$SourceUserID", "ReferralLevel": "$ReferralLevel"},
+			"Total":      bson.M{"$sum": "$Amount"},
+			"Entries":    bson.M{"$sum": 1},
+			"LastEarned": bson.M{"$max": "$CreateDate"},
+		}}},
+		{{Key: "$addFields", Value: bson.M{
+			"SourceUserID":  "$_id.SourceUserID",
+			"ReferralLevel": "$_id.ReferralLevel",
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	referred := make([]ReferredUser, 0)
+	if err := cursor.All(ctx, &referred); err != nil {
+		return nil, err
+	}
+	return newReferralSummary(referrerID, referred), nil
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go-ubipay-websocket/models"
+	"go-ubipay-websocket/points"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UserStore looks up TblUser records
+type UserStore interface {
+	GetUserBySessionToken(sessionToken string) (*models.User, error)
+	GetUserByID(userID primitive.ObjectID) (*models.User, error)
+	GetUserByUsername(username string) (*models.User, error)
+}
+
+// UserWatcher streams TblUser changes. Only MongoDB change streams (replica
+// set required) support it; other backends return ErrWatchUnsupported.
+type UserWatcher interface {
+	// WatchUsers calls onChange with the _id of every updated, replaced or
+	// deleted user until ctx is cancelled or the stream fails
+	WatchUsers(ctx context.Context, onChange func(userID primitive.ObjectID)) error
+}
+
+// RateStore reads the TblAccrualRate tier table
+type RateStore interface {
+	ListAccrualRates() ([]models.AccrualRate, error)
+}
+
+// CampaignStore manages TblCampaign boost campaigns
+type CampaignStore interface {
+	// ListCampaigns returns the campaigns ending after endedAfter (all of
+	// them for the zero time), earliest start first
+	ListCampaigns(endedAfter time.Time) ([]models.Campaign, error)
+	InsertCampaign(campaign *models.Campaign) error
+	DisableCampaign(campaignID primitive.ObjectID) error
+}
+
+// WalletStore manages TblUserWallet balances and the TblTransactionMovement ledger
+type WalletStore interface {
+	GetUserWallet(userID primitive.ObjectID) (*models.UserWallet, error)
+	CreateUserWallet(userID primitive.ObjectID) (*models.UserWallet, error)
+	UpdateWalletBalance(userID primitive.ObjectID, amount points.Points) (*models.UserWallet, error)
+	CreateTransaction(userID primitive.ObjectID, username string, transactionType, targetType int, amount, beforeAmt, afterAmt points.Points) error
+	// AccruePoints credits movement.Amount, clamped to what caps still
+	// allow, as a TargetTypePointAccrual row and pays the referral shares
+	// of the credit, atomically. It returns ErrDuplicateTransaction if the
+	// idempotency key was already used and ErrCapReached if no allowance is
+	// left.
+	AccruePoints(movement Movement, caps AccrualCaps, referrals []ReferralShare) (*AccrualOutcome, error)
+	// AccrualAllowance reports the user's usage of each enabled cap
+	AccrualAllowance(userID primitive.ObjectID, caps AccrualCaps) (*Allowance, error)
+	// AdjustBalance applies a signed manual correction with a
+	// TargetTypeAdminAdjustment ledger row. A debit larger than the balance
+	// fails with ErrInsufficientBalance.
+	AdjustBalance(userID primitive.ObjectID, username string, amount points.Points, reason, operator, idempotencyKey string) (*models.TransactionMovement, error)
+	// ListTransactions returns one page of the user's ledger, newest first
+	ListTransactions(query HistoryQuery) (*HistoryPage, error)
+	// ReferralSummary totals the referral bonuses paid to referrerID
+	ReferralSummary(referrerID primitive.ObjectID) (*ReferralSummary, error)
+}
+
+// ReconcileStore supports the ledger reconciliation job
+type ReconcileStore interface {
+	// ListWallets returns every enabled point wallet
+	ListWallets() ([]models.UserWallet, error)
+	// InsertLedgerEntry records a ledger row without changing the balance;
+	// afterAmt is the balance the row ends at
+	InsertLedgerEntry(movement Movement, afterAmt points.Points) (*models.TransactionMovement, error)
+	// RecordDiscrepancy stores a finding, or refreshes LastSeen/RunID (and
+	// CorrectionID if set) when the same finding was already recorded
+	RecordDiscrepancy(discrepancy *models.LedgerDiscrepancy) error
+	// ListDiscrepancies returns the most recently seen findings first
+	ListDiscrepancies(limit int) ([]models.LedgerDiscrepancy, error)
+	// ReconcileCheckpoint returns where the last run stopped in the user's
+	// ledger, nil if it was never walked
+	ReconcileCheckpoint(userID primitive.ObjectID) (*models.ReconcileCheckpoint, error)
+	// SaveReconcileCheckpoint replaces the user's checkpoint
+	SaveReconcileCheckpoint(checkpoint *models.ReconcileCheckpoint) error
+}
+
+// AuditStore records admin API calls in TblAdminAuditLog
+type AuditStore interface {
+	InsertAdminAudit(entry *models.AdminAuditLog) error
+}
+
+// Store is the full storage backend used by the handlers and cron jobs.
+// MongoStore and MemoryStore both implement it.
+type Store interface {
+	UserStore
+	RateStore
+	CampaignStore
+	WalletStore
+	ReconcileStore
+	AuditStore
+	Disconnect() error
+}
+
+var (
+	_ Store = (*MongoStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*FallbackStore)(nil)
+
+	_ UserWatcher = (*MongoStore)(nil)
+	_ UserWatcher = (*FallbackStore)(nil)
+)
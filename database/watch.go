@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// WatchUsers opens a change stream on TblUser. Inserts are ignored; a new
+// user cannot invalidate an existing session.
+func (db *MongoStore) WatchUsers(ctx context.Context, onChange func(userID primitive.ObjectID)) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"operationType": bson.M{"$in": bson.A{"update", "replace", "delete"}}}}},
+	}
+
+	stream, err := db.User.Watch(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var event struct {
+			DocumentKey struct {
+				ID primitive.ObjectID `bson:"_id"`
+			} `bson:"documentKey"`
+		}
+		if err := stream.Decode(&event); err != nil {
+			return err
+		}
+		onChange(event.DocumentKey.ID)
+	}
+	return stream.Err()
+}
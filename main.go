@@ -1,20 +1,30 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"go-ubipay-websocket/accrual"
+	"go-ubipay-websocket/admin"
+	"go-ubipay-websocket/auth"
 	"go-ubipay-websocket/config"
 	"go-ubipay-websocket/cron"
 	"go-ubipay-websocket/database"
+	"go-ubipay-websocket/models"
+	"go-ubipay-websocket/points"
+	"go-ubipay-websocket/reconcile"
 	"go-ubipay-websocket/websocket"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	fiberwebsocket "github.com/gofiber/websocket/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func main() {
@@ -22,26 +32,67 @@ func main() {
 	cfg := config.LoadConfig()
 	log.Println("🚀 Starting Real-Time Point Mining System (MVP)")
 	log.Printf("📋 Configuration loaded: Port=%s, MongoDB=%s", cfg.ServerPort, cfg.MongoDBName)
-	log.Println("🔧 System will automatically use test mode if MongoDB is not available")
+	log.Printf("🔧 Database mode: %s, auth mode: %s", cfg.DatabaseMode, cfg.AuthMode)
 
-	// Initialize database (MongoDB operations commented out for testing)
-	db, err := database.ConnectMongoDB(cfg)
+	// Initialize database (falls back to the in-memory store depending on DB_MODE)
+	db, err := database.Open(cfg)
 	if err != nil {
 		log.Fatalf("❌ Failed to initialize database: %v", err)
 	}
 	defer db.Disconnect()
 
 	// Initialize session manager
-	sessionManager := websocket.NewSessionManager()
+	sessionManager := websocket.NewSessionManager(cfg)
+
+	// Shared accrual path for the cron job and disconnect settlement
+	accruer := accrual.NewAccruer(cfg, db)
+
+	// VIP / user type rate table; a broken rates file is a config error,
+	// an unreachable collection falls back to 1x until reloaded
+	if n, err := accruer.LoadRates(); err != nil {
+		if cfg.AccrualRatesFile != "" {
+			log.Fatalf("❌ Failed to load accrual rates: %v", err)
+		}
+		log.Printf("⚠️ Failed to load accrual rates, everyone accrues at 1x: %v", err)
+	} else {
+		log.Printf("🏅 Loaded %d accrual rates", n)
+	}
+
+	// Token authentication (JWT and/or TblUser.SessionToken)
+	authenticator, err := auth.NewFromConfig(cfg, db)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize authentication: %v", err)
+	}
+
+	adminGuard, err := admin.NewGuard(cfg, authenticator, db)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize admin authentication: %v", err)
+	}
 
 	// Initialize WebSocket handler
-	wsHandler := websocket.NewWebSocketHandler(cfg, sessionManager, db)
+	wsHandler := websocket.NewWebSocketHandler(cfg, sessionManager, db, accruer, authenticator)
+
+	// Disconnect sessions that stop answering heartbeats
+	wsHandler.StartReaper()
+	defer wsHandler.StopReaper()
+
+	// Disconnect sessions whose token was revoked or whose user was disabled
+	wsHandler.StartRevalidator()
+	defer wsHandler.StopRevalidator()
 
 	// Initialize accrual job
-	accrualJob := cron.NewAccrualJob(cfg, sessionManager, db, wsHandler)
+	accrualJob := cron.NewAccrualJob(cfg, sessionManager, db, wsHandler, accruer)
 	accrualJob.Start()
 	defer accrualJob.Stop()
 
+	// Ledger reconciliation runs on the accrual job's cron
+	reconciler := reconcile.NewReconciler(db)
+	cron.NewReconcileJob(cfg, reconciler).Register(accrualJob)
+
+	// Boost campaigns are reloaded and announced on the accrual job's cron
+	campaignJob := cron.NewCampaignJob(cfg, accruer, wsHandler)
+	campaignJob.Register(accrualJob)
+
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
 		AppName: "UbiPay WebSocket Server",
@@ -58,18 +109,37 @@ func main() {
 			"status":    "healthy",
 			"timestamp": time.Now(),
 			"version":   "1.0.0",
+			"accrual": fiber.Map{
+				"schedule": accrualJob.Schedule(),
+				"points":   cfg.AccrualPoints,
+				"period":   cfg.AccrualPeriod.String(),
+				"caps": fiber.Map{
+					"daily":    cfg.AccrualDailyCap,
+					"weekly":   cfg.AccrualWeeklyCap,
+					"lifetime": cfg.AccrualLifetimeCap,
+				},
+			},
 		})
 	})
 
-	// WebSocket endpoint (authentication removed for testing)
+	// WebSocket endpoint, authenticated according to AUTH_MODE before the upgrade
 	app.Get("/ws", wsHandler.HandleWebSocket, func(c *fiber.Ctx) error {
 		// Store the fiber context in locals for WebSocket handler to access
 		c.Locals("fiberCtx", c)
 		return fiberwebsocket.New(wsHandler.WebSocketConnection)(c)
 	})
 
+	// Transaction history of the token's user
+	app.Get("/api/transactions", wsHandler.HandleHistory)
+
+	// Referral bonus earnings of the token's user
+	app.Get("/api/referrals", wsHandler.HandleReferrals)
+
+	// Admin API: every call is authenticated and written to TblAdminAuditLog
+	adminAPI := app.Group("/admin", adminGuard.Authenticate)
+
 	// Manual accrual trigger endpoint (for testing)
-	app.Post("/admin/accrual/run", func(c *fiber.Ctx) error {
+	adminAPI.Post("/accrual/run", admin.Require(admin.RoleOperator), func(c *fiber.Ctx) error {
 		accrualJob.RunManualAccrual()
 		return c.JSON(fiber.Map{
 			"message": "Manual accrual job triggered",
@@ -78,27 +148,308 @@ func main() {
 	})
 
 	// Get active sessions endpoint
-	app.Get("/admin/sessions", func(c *fiber.Ctx) error {
+	adminAPI.Get("/sessions", admin.Require(admin.RoleReadOnly), func(c *fiber.Ctx) error {
 		activeSessions := sessionManager.GetActiveSessions()
 		sessionInfo := make([]fiber.Map, len(activeSessions))
 
 		for i, session := range activeSessions {
+			info := session.Info()
+			lastAccrual, _, tier, _ := sessionManager.AccrualState(info.UserID)
 			sessionInfo[i] = fiber.Map{
-				"user_id":        session.UserID.Hex(),
-				"username":       session.Username,
+				"conn_id":        session.ConnID,
+				"user_id":        info.UserID.Hex(),
+				"username":       info.Username,
 				"connected_at":   session.ConnectedAt,
-				"last_accrual":   session.LastAccrualAt,
-				"last_heartbeat": session.LastHeartbeat,
-				"is_active":      session.IsActive,
+				"last_accrual":   lastAccrual,
+				"accrual_rate":   tier.Rate,
+				"last_heartbeat": info.LastHeartbeat,
+				"is_active":      info.IsActive,
+				"queue_depth":    session.QueueDepth(),
+				"dropped":        session.DroppedMessages(),
 			}
 		}
 
+		totalDepth, maxDepth, dropped := sessionManager.QueueStats()
 		return c.JSON(fiber.Map{
 			"total_sessions": len(activeSessions),
+			"total_users":    len(sessionManager.GetActiveUsers()),
 			"sessions":       sessionInfo,
+			"outbound_queue": fiber.Map{
+				"total_depth": totalDepth,
+				"max_depth":   maxDepth,
+				"dropped":     dropped,
+			},
 		})
 	})
 
+	// Force-disconnect every connection of a user, or a single one
+	// Query: reason, settle=false to forfeit pending accrual, ban=<duration>
+	disconnect := func(c *fiber.Ctx) error {
+		userID, err := primitive.ObjectIDFromHex(c.Params("userId"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+		}
+		opts, err := parseDisconnectOptions(c)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		if opts.ban > 0 {
+			sessionManager.Ban(userID, time.Now().Add(opts.ban))
+		}
+
+		closed := 0
+		if connID := c.Params("connId"); connID != "" {
+			if wsHandler.DisconnectConnection(userID, connID, opts.reason, opts.settle) {
+				closed = 1
+			}
+		} else {
+			closed = wsHandler.DisconnectUser(userID, opts.reason, opts.settle)
+		}
+		if closed == 0 && opts.ban == 0 {
+			return fiber.NewError(fiber.StatusNotFound, "No matching session")
+		}
+
+		response := fiber.Map{
+			"user_id": userID.Hex(),
+			"closed":  closed,
+			"settled": opts.settle,
+		}
+		if until, banned := sessionManager.BannedUntil(userID); banned {
+			response["banned_until"] = until
+		}
+		return c.JSON(response)
+	}
+	adminAPI.Delete("/sessions/:userId", admin.Require(admin.RoleOperator), disconnect)
+	adminAPI.Delete("/sessions/:userId/:connId", admin.Require(admin.RoleOperator), disconnect)
+
+	// Lift a reconnect ban
+	adminAPI.Delete("/bans/:userId", admin.Require(admin.RoleOperator), func(c *fiber.Ctx) error {
+		userID, err := primitive.ObjectIDFromHex(c.Params("userId"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+		}
+		if !sessionManager.Unban(userID) {
+			return fiber.NewError(fiber.StatusNotFound, "User is not banned")
+		}
+		return c.JSON(fiber.Map{"user_id": userID.Hex(), "banned": false})
+	})
+
+	// Manual wallet correction with a ledger row; amount is signed
+	adminAPI.Post("/wallets/:userId/adjust", admin.Require(admin.RoleOperator), func(c *fiber.Ctx) error {
+		userID, err := primitive.ObjectIDFromHex(c.Params("userId"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+		}
+
+		var req struct {
+			Amount   points.Points `json:"amount"`
+			Reason   string        `json:"reason"`
+			Operator string        `json:"operator"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+		if req.Amount == 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "amount must be non-zero")
+		}
+		if strings.TrimSpace(req.Reason) == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "reason is required")
+		}
+
+		// The ledger records who actually made the call; a name given in
+		// the body is kept in the remark only
+		operator := admin.CurrentPrincipal(c).Name
+		remark := req.Reason
+		if name := strings.TrimSpace(req.Operator); name != "" && name != operator {
+			remark = fmt.Sprintf("%s (requested by %s)", req.Reason, name)
+		}
+
+		// Ledger rows carry the username; a JWT-only user may have no
+		// TblUser record, so fall back to a live session
+		var username string
+		if user, err := db.GetUserByID(userID); err == nil {
+			username = user.Username
+		} else if err != database.ErrUserNotFound {
+			return err
+		} else if sessions := sessionManager.GetUserSessions(userID); len(sessions) > 0 {
+			username = sessions[0].Info().Username
+		} else {
+			return fiber.NewError(fiber.StatusNotFound, "User not found")
+		}
+
+		idempotencyKey := ""
+		if key := c.Get("Idempotency-Key"); key != "" {
+			idempotencyKey = "adjust:" + userID.Hex() + ":" + key
+		}
+
+		transaction, err := db.AdjustBalance(userID, username, req.Amount, remark, operator, idempotencyKey)
+		switch err {
+		case nil:
+		case database.ErrInsufficientBalance:
+			return fiber.NewError(fiber.StatusConflict, "Adjustment would make the balance negative")
+		case database.ErrDuplicateTransaction:
+			return fiber.NewError(fiber.StatusConflict, "Adjustment with this Idempotency-Key was already applied")
+		default:
+			return err
+		}
+
+		notified := wsHandler.BroadcastBalanceUpdate(userID, transaction.AfterAmt)
+		return c.JSON(fiber.Map{
+			"transaction": transaction,
+			"balance":     transaction.AfterAmt,
+			"notified":    notified,
+		})
+	})
+
+	// Transaction history of any user, same query parameters as /api/transactions
+	adminAPI.Get("/wallets/:userId/transactions", admin.Require(admin.RoleReadOnly), func(c *fiber.Ctx) error {
+		userID, err := primitive.ObjectIDFromHex(c.Params("userId"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+		}
+		return wsHandler.ServeHistory(c, userID)
+	})
+
+	// Referral bonus earnings of any user
+	adminAPI.Get("/referrals/:userId", admin.Require(admin.RoleReadOnly), func(c *fiber.Ctx) error {
+		userID, err := primitive.ObjectIDFromHex(c.Params("userId"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+		}
+		return wsHandler.ServeReferrals(c, userID)
+	})
+
+	// Ledger reconciliation findings and the last run's report
+	adminAPI.Get("/reconciliation", admin.Require(admin.RoleReadOnly), func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", 100)
+		if limit <= 0 || limit > 1000 {
+			return fiber.NewError(fiber.StatusBadRequest, "limit must be between 1 and 1000")
+		}
+		discrepancies, err := db.ListDiscrepancies(limit)
+		if err != nil {
+			return err
+		}
+		return c.JSON(fiber.Map{
+			"last_run":      reconciler.LastRun(),
+			"discrepancies": discrepancies,
+		})
+	})
+
+	// Run the reconciliation now; ?correct=true writes compensating entries
+	adminAPI.Post("/reconciliation/run", admin.Require(admin.RoleOperator), func(c *fiber.Ctx) error {
+		correct := cfg.ReconcileAutoCorrect
+		if value := c.Query("correct"); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "Invalid correct value")
+			}
+			correct = parsed
+		}
+		full := false
+		if value := c.Query("full"); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "Invalid full value")
+			}
+			full = parsed
+		}
+
+		report, err := reconciler.Run(correct, full)
+		if err != nil {
+			return err
+		}
+		return c.JSON(report)
+	})
+
+	// Accrual rate table, and reloading it from the file or collection
+	adminAPI.Get("/rates", admin.Require(admin.RoleReadOnly), func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"rates": accruer.Rates()})
+	})
+
+	adminAPI.Post("/rates/reload", admin.Require(admin.RoleOperator), func(c *fiber.Ctx) error {
+		n, err := accruer.LoadRates()
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to load accrual rates: "+err.Error())
+		}
+		wsHandler.RefreshRates()
+		return c.JSON(fiber.Map{"loaded": n, "rates": accruer.Rates()})
+	})
+
+	// Boost campaigns, and the ones running right now
+	adminAPI.Get("/campaigns", admin.Require(admin.RoleReadOnly), func(c *fiber.Ctx) error {
+		campaigns, err := db.ListCampaigns(time.Time{})
+		if err != nil {
+			return err
+		}
+		return c.JSON(fiber.Map{
+			"campaigns": campaigns,
+			"active":    accruer.ActiveCampaigns(time.Now()),
+		})
+	})
+
+	// Create a campaign; without start_at it starts right away
+	adminAPI.Post("/campaigns", admin.Require(admin.RoleOperator), func(c *fiber.Ctx) error {
+		var req struct {
+			Name       string               `json:"name"`
+			Multiplier points.Points        `json:"multiplier"`
+			StartAt    time.Time            `json:"start_at"`
+			EndAt      time.Time            `json:"end_at"`
+			UserVips   []int                `json:"user_vips"`
+			UserIDs    []primitive.ObjectID `json:"user_ids"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+		if strings.TrimSpace(req.Name) == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "name is required")
+		}
+		if req.Multiplier <= 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "multiplier must be positive")
+		}
+		now := time.Now()
+		if req.StartAt.IsZero() {
+			req.StartAt = now
+		}
+		if !req.EndAt.After(req.StartAt) || !req.EndAt.After(now) {
+			return fiber.NewError(fiber.StatusBadRequest, "end_at must be after start_at and in the future")
+		}
+
+		campaign := &models.Campaign{
+			Name:       strings.TrimSpace(req.Name),
+			Multiplier: req.Multiplier,
+			StartAt:    req.StartAt,
+			EndAt:      req.EndAt,
+			UserVips:   req.UserVips,
+			UserIDs:    req.UserIDs,
+			Enable:     true,
+			CreateBy:   admin.CurrentPrincipal(c).Name,
+			CreateDate: now,
+		}
+		if err := db.InsertCampaign(campaign); err != nil {
+			return err
+		}
+		campaignJob.Check()
+		return c.Status(fiber.StatusCreated).JSON(campaign)
+	})
+
+	// End a campaign early; connected users get campaign_ended
+	adminAPI.Delete("/campaigns/:id", admin.Require(admin.RoleOperator), func(c *fiber.Ctx) error {
+		campaignID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid campaign ID")
+		}
+		switch err := db.DisableCampaign(campaignID); err {
+		case nil:
+		case database.ErrCampaignNotFound:
+			return fiber.NewError(fiber.StatusNotFound, "Campaign not found")
+		default:
+			return err
+		}
+		campaignJob.Check()
+		return c.JSON(fiber.Map{"campaign_id": campaignID.Hex(), "enable": false})
+	})
+
 	// Handle graceful shutdown
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
@@ -107,6 +458,8 @@ func main() {
 		<-shutdown
 		log.Println("🛑 Shutdown signal received, stopping services...")
 		accrualJob.Stop()
+		wsHandler.StopReaper()
+		wsHandler.StopRevalidator()
 		db.Disconnect()
 		log.Println("👋 Services stopped, exiting...")
 		os.Exit(0)
@@ -118,3 +471,33 @@ func main() {
 		log.Fatalf("❌ Failed to start server: %v", err)
 	}
 }
+
+type disconnectOptions struct {
+	reason string
+	settle bool
+	ban    time.Duration
+}
+
+func parseDisconnectOptions(c *fiber.Ctx) (disconnectOptions, error) {
+	opts := disconnectOptions{
+		reason: c.Query("reason", "disconnected by administrator"),
+		settle: true,
+	}
+
+	if value := c.Query("settle"); value != "" {
+		settle, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid settle value %q", value)
+		}
+		opts.settle = settle
+	}
+
+	if value := c.Query("ban"); value != "" {
+		ban, err := time.ParseDuration(value)
+		if err != nil || ban < 0 {
+			return opts, fmt.Errorf("invalid ban duration %q", value)
+		}
+		opts.ban = ban
+	}
+	return opts, nil
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"time"
 
+	"go-ubipay-websocket/points"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -20,6 +22,20 @@ type UserWallet struct {
 	ModifiedDate time.Time            `bson:"ModifiedDate" json:"modified_date"`
 }
 
+// TransactionMovement.TransactionType values
+const (
+	TransactionTypeDebit  = 1
+	TransactionTypeCredit = 2
+)
+
+// TransactionMovement.TargetType values
+const (
+	TargetTypePointAccrual    = 1
+	TargetTypeAdminAdjustment = 2
+	TargetTypeReconciliation  = 3
+	TargetTypeReferralBonus   = 4
+)
+
 // TransactionMovement represents the TblTransactionMovement collection structure
 type TransactionMovement struct {
 	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
@@ -27,9 +43,16 @@ type TransactionMovement struct {
 	Username        string             `bson:"Username" json:"username"`
 	TransactionType int                `bson:"TransactionType" json:"transaction_type"`
 	TargetType      int                `bson:"TargetType" json:"target_type"`
-	Amount          int                `bson:"Amount" json:"amount"`
-	BeforeAmt       int                `bson:"BeforeAmt" json:"before_amt"`
-	AfterAmt        int                `bson:"AfterAmt" json:"after_amt"`
+	Amount          points.Points      `bson:"Amount" json:"amount"`
+	BeforeAmt       points.Points      `bson:"BeforeAmt" json:"before_amt"`
+	AfterAmt        points.Points      `bson:"AfterAmt" json:"after_amt"`
+	IdempotencyKey  string             `bson:"IdempotencyKey,omitempty" json:"idempotency_key,omitempty"`
+	Rate            points.Points      `bson:"Rate,omitempty" json:"rate,omitempty"`                    // tier multiplier of an accrual
+	Boost           points.Points      `bson:"Boost,omitempty" json:"boost,omitempty"`                  // campaign multiplier of an accrual
+	CampaignID      primitive.ObjectID `bson:"CampaignID,omitempty" json:"campaign_id,omitempty"`       // campaign that applied for most of it
+	SourceUserID    primitive.ObjectID `bson:"SourceUserID,omitempty" json:"source_user_id,omitempty"`  // referred user a bonus was paid from
+	ReferralLevel   int                `bson:"ReferralLevel,omitempty" json:"referral_level,omitempty"` // 1 = direct referrer
+	Remark          string             `bson:"Remark,omitempty" json:"remark,omitempty"`
 	Enable          bool               `bson:"Enable" json:"enable"`
 	CreateBy        string             `bson:"CreateBy" json:"create_by"`
 	CreateDate      time.Time          `bson:"CreateDate" json:"create_date"`
@@ -61,3 +84,92 @@ type User struct {
 	ReferCode    string             `bson:"ReferCode" json:"ReferCode"`
 	SessionToken string             `bson:"SessionToken" json:"SessionToken"`
 }
+
+// AdminAuditLog represents the TblAdminAuditLog collection structure; one
+// entry per admin API call, including rejected ones
+type AdminAuditLog struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Actor      string             `bson:"Actor" json:"actor"`
+	AuthMethod string             `bson:"AuthMethod" json:"auth_method"`
+	Role       string             `bson:"Role" json:"role"`
+	HTTPMethod string             `bson:"HTTPMethod" json:"http_method"`
+	Path       string             `bson:"Path" json:"path"`
+	Query      string             `bson:"Query,omitempty" json:"query,omitempty"`
+	Status     int                `bson:"Status" json:"status"`
+	RemoteIP   string             `bson:"RemoteIP" json:"remote_ip"`
+	DurationMs int64              `bson:"DurationMs" json:"duration_ms"`
+	CreateDate time.Time          `bson:"CreateDate" json:"create_date"`
+}
+
+// LedgerDiscrepancy.Kind values
+const (
+	// DiscrepancyChainGap: a row's BeforeAmt differs from the previous row's AfterAmt
+	DiscrepancyChainGap = "chain_gap"
+	// DiscrepancyAmountMismatch: AfterAmt - BeforeAmt differs from the signed Amount
+	DiscrepancyAmountMismatch = "amount_mismatch"
+	// DiscrepancyBalanceMismatch: the wallet balance differs from the last AfterAmt
+	DiscrepancyBalanceMismatch = "balance_mismatch"
+)
+
+// LedgerDiscrepancy represents the TblLedgerDiscrepancy collection structure.
+// The same finding seen by several reconciliation runs is one document.
+type LedgerDiscrepancy struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID        primitive.ObjectID `bson:"UserID" json:"user_id"`
+	Kind          string             `bson:"Kind" json:"kind"`
+	TransactionID primitive.ObjectID `bson:"TransactionID" json:"transaction_id"`
+	Expected      points.Points      `bson:"Expected" json:"expected"`
+	Actual        points.Points      `bson:"Actual" json:"actual"`
+	// CorrectionID is the compensating ledger row, if one was written
+	CorrectionID primitive.ObjectID `bson:"CorrectionID,omitempty" json:"correction_id,omitempty"`
+	RunID        string             `bson:"RunID" json:"run_id"`
+	FirstSeen    time.Time          `bson:"FirstSeen" json:"first_seen"`
+	LastSeen     time.Time          `bson:"LastSeen" json:"last_seen"`
+}
+
+// ReconcileCheckpoint represents the TblReconcileCheckpoint collection
+// structure: the last ledger row of a wallet that reconciliation walked, so
+// the next run only reads the rows after it
+type ReconcileCheckpoint struct {
+	UserID        primitive.ObjectID `bson:"_id" json:"user_id"`
+	TransactionID primitive.ObjectID `bson:"TransactionID" json:"transaction_id"`
+	AfterAmt      points.Points      `bson:"AfterAmt" json:"after_amt"`
+	ModifiedDate  time.Time          `bson:"ModifiedDate" json:"modified_date"`
+}
+
+// AccrualCounter is the running accrual total of a user for one cap window
+// (Period "daily:2026-01-31", "weekly:2026-W05" or "lifetime"). Windowed
+// counters carry ExpiresAt so the TTL index removes them once they ended.
+type AccrualCounter struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID       primitive.ObjectID `bson:"UserID" json:"user_id"`
+	Period       string             `bson:"Period" json:"period"`
+	Total        points.Points      `bson:"Total" json:"total"`
+	ExpiresAt    *time.Time         `bson:"ExpiresAt,omitempty" json:"expires_at,omitempty"`
+	ModifiedDate time.Time          `bson:"ModifiedDate" json:"modified_date"`
+}
+
+// AccrualRate maps a VIP level and/or user type to an accrual multiplier.
+// A nil UserType or UserVip matches any value.
+type AccrualRate struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	UserType   *int               `bson:"UserType,omitempty" json:"user_type,omitempty"`
+	UserVip    *int               `bson:"UserVip,omitempty" json:"user_vip,omitempty"`
+	Multiplier points.Points      `bson:"Multiplier" json:"multiplier"`
+	Remark     string             `bson:"Remark,omitempty" json:"remark,omitempty"`
+}
+
+// Campaign represents the TblCampaign collection structure: a time-boxed
+// accrual multiplier, optionally limited to some VIP levels or users
+type Campaign struct {
+	ID         primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Name       string               `bson:"Name" json:"name"`
+	Multiplier points.Points        `bson:"Multiplier" json:"multiplier"`
+	StartAt    time.Time            `bson:"StartAt" json:"start_at"`
+	EndAt      time.Time            `bson:"EndAt" json:"end_at"`
+	UserVips   []int                `bson:"UserVips,omitempty" json:"user_vips,omitempty"`
+	UserIDs    []primitive.ObjectID `bson:"UserIDs,omitempty" json:"user_ids,omitempty"`
+	Enable     bool                 `bson:"Enable" json:"enable"`
+	CreateBy   string               `bson:"CreateBy" json:"create_by"`
+	CreateDate time.Time            `bson:"CreateDate" json:"create_date"`
+}
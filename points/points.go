@@ -0,0 +1,182 @@
+package points
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Points is an exact decimal amount of points with Scale fractional digits,
+// held as an integer number of units (1 unit = 0.0001 point). Addition and
+// subtraction are plain integer arithmetic.
+type Points int64
+
+// Scale is the number of fractional digits a Points value keeps
+const Scale = 4
+
+// One is a single whole point
+const One Points = 10000
+
+var (
+	ErrInvalid   = errors.New("invalid points value")
+	ErrPrecision = fmt.Errorf("points value has more than %d decimal places", Scale)
+	ErrRange     = errors.New("points value out of range")
+)
+
+// FromInt converts a whole number of points
+func FromInt(n int64) Points {
+	return Points(n) * One
+}
+
+// Parse reads a decimal such as "12", "-0.5" or "1.2E+3"
+func Parse(s string) (Points, error) {
+	s = strings.TrimSpace(s)
+	// big.Rat also accepts fractions like "1/3"; those are not decimals
+	if s == "" || strings.ContainsAny(s, "/") {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+	return FromRat(r)
+}
+
+// FromRat converts an exact rational; it fails if r needs more than Scale
+// decimal places
+func FromRat(r *big.Rat) (Points, error) {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt64(int64(One)))
+	if !scaled.IsInt() {
+		return 0, fmt.Errorf("%w: %s", ErrPrecision, r.FloatString(Scale+2))
+	}
+	if !scaled.Num().IsInt64() {
+		return 0, fmt.Errorf("%w: %s", ErrRange, r.FloatString(0))
+	}
+	return Points(scaled.Num().Int64()), nil
+}
+
+// Truncate drops the digits of r beyond Scale, rounding toward zero
+func Truncate(r *big.Rat) Points {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt64(int64(One)))
+	return Points(new(big.Int).Quo(scaled.Num(), scaled.Denom()).Int64())
+}
+
+// FromDecimal128 converts a MongoDB Decimal128 exactly
+func FromDecimal128(d primitive.Decimal128) (Points, error) {
+	coefficient, exp, err := d.BigInt()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalid, d)
+	}
+
+	r := new(big.Rat).SetInt(coefficient)
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(exp))), nil)
+	if exp >= 0 {
+		r.Mul(r, new(big.Rat).SetInt(pow))
+	} else {
+		r.Quo(r, new(big.Rat).SetInt(pow))
+	}
+	return FromRat(r)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Decimal128 returns the value with trailing fractional zeros removed
+func (p Points) Decimal128() primitive.Decimal128 {
+	coefficient, exp := int64(p), -Scale
+	for exp < 0 && coefficient%10 == 0 {
+		coefficient /= 10
+		exp++
+	}
+	d, _ := primitive.ParseDecimal128FromBigInt(big.NewInt(coefficient), exp)
+	return d
+}
+
+// Rat returns the exact value as a rational
+func (p Points) Rat() *big.Rat {
+	return big.NewRat(int64(p), int64(One))
+}
+
+// Float64 is for display and ratios only; it is not exact
+func (p Points) Float64() float64 {
+	return float64(p) / float64(One)
+}
+
+// String formats the value without trailing fractional zeros, e.g. "12.5"
+func (p Points) String() string {
+	sign := ""
+	units := uint64(p)
+	if p < 0 {
+		sign = "-"
+		units = uint64(-p)
+	}
+
+	whole := strconv.FormatUint(units/uint64(One), 10)
+	frac := units % uint64(One)
+	if frac == 0 {
+		return sign + whole
+	}
+	digits := strings.TrimRight(fmt.Sprintf("%0*d", Scale, frac), "0")
+	return sign + whole + "." + digits
+}
+
+// MarshalJSON writes a JSON number with the exact decimal digits
+func (p Points) MarshalJSON() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a decimal string
+func (p *Points) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	value, err := Parse(strings.Trim(s, `"`))
+	if err != nil {
+		return err
+	}
+	*p = value
+	return nil
+}
+
+// MarshalBSONValue stores the value as Decimal128
+func (p Points) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(p.Decimal128())
+}
+
+// UnmarshalBSONValue reads Decimal128 and, for ledger rows written before
+// points were decimal, int32, int64 and double values
+func (p *Points) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+
+	var value Points
+	var err error
+	switch t {
+	case bsontype.Decimal128:
+		value, err = FromDecimal128(raw.Decimal128())
+	case bsontype.Int32:
+		value = FromInt(int64(raw.Int32()))
+	case bsontype.Int64:
+		value = FromInt(raw.Int64())
+	case bsontype.Double:
+		value, err = Parse(strconv.FormatFloat(raw.Double(), 'f', -1, 64))
+	case bsontype.Null:
+	default:
+		err = fmt.Errorf("%w: BSON type %s", ErrInvalid, t)
+	}
+	if err != nil {
+		return err
+	}
+	*p = value
+	return nil
+}
@@ -0,0 +1,93 @@
+package points
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Points
+		err  error
+	}{
+		{in: "12", want: 120000},
+		{in: " 3.1416 ", want: 31416},
+		{in: "-0.5", want: -5000},
+		{in: "0.0001", want: 1},
+		{in: "1.2E+3", want: 12000000},
+		{in: "", err: ErrInvalid},
+		{in: "abc", err: ErrInvalid},
+		{in: "1/3", err: ErrInvalid},
+		{in: "0.00001", err: ErrPrecision},
+		{in: "1e20", err: ErrRange},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q) error = %v, want %v", tt.in, err, tt.err)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFromDecimal128(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Points
+		err  error
+	}{
+		{in: "12.50", want: 125000},
+		{in: "1E+2", want: 1000000},
+		{in: "-0.0001", want: -1},
+		{in: "0", want: 0},
+		{in: "0.00001", err: ErrPrecision},
+		{in: "NaN", err: ErrInvalid},
+	}
+	for _, tt := range tests {
+		d, err := primitive.ParseDecimal128(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := FromDecimal128(d)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("FromDecimal128(%s) error = %v, want %v", tt.in, err, tt.err)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("FromDecimal128(%s) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	for _, p := range []Points{0, 1, -1, 125000, FromInt(-7), 123456789} {
+		got, err := FromDecimal128(p.Decimal128())
+		if err != nil || got != p {
+			t.Errorf("round trip of %d = %d, %v", p, got, err)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in   Points
+		want string
+	}{
+		{0, "0"},
+		{FromInt(3), "3"},
+		{125000, "12.5"},
+		{1, "0.0001"},
+		{-1, "-0.0001"},
+		{-5000, "-0.5"},
+		{31416, "3.1416"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Points(%d).String() = %q, want %q", int64(tt.in), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package reconcile
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go-ubipay-websocket/database"
+	"go-ubipay-websocket/models"
+	"go-ubipay-websocket/points"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ledgerPageSize is how many ledger rows are read per query
+const ledgerPageSize = 500
+
+// checkpointLag keeps recent rows out of the checkpoint. A transaction can
+// commit after a row with a later _id, so rows younger than this are read
+// again by the next run.
+const checkpointLag = 5 * time.Minute
+
+// Reconciler recomputes each wallet's balance from its TblTransactionMovement
+// chain and records every inconsistency it finds
+type Reconciler struct {
+	db database.Store
+	// runMu serialises scheduled and manual runs
+	runMu   sync.Mutex
+	lastMu  sync.RWMutex
+	lastRun *Report
+}
+
+// Report summarises one reconciliation run
+type Report struct {
+	RunID         string                     `json:"run_id"`
+	StartedAt     time.Time                  `json:"started_at"`
+	Duration      string                     `json:"duration"`
+	Wallets       int                        `json:"wallets"`
+	Skipped       int                        `json:"skipped"`
+	Failed        int                        `json:"failed"`
+	Corrected     int                        `json:"corrected"`
+	Discrepancies []models.LedgerDiscrepancy `json:"discrepancies"`
+}
+
+func NewReconciler(db database.Store) *Reconciler {
+	return &Reconciler{db: db}
+}
+
+// LastRun returns the report of the most recent run, nil before the first
+func (r *Reconciler) LastRun() *Report {
+	r.lastMu.RLock()
+	defer r.lastMu.RUnlock()
+	return r.lastRun
+}
+
+// Run checks every wallet. Each wallet's ledger is read from where the
+// previous run stopped; with full, from its first row. With correct, a
+// wallet whose balance differs from its ledger gets a compensating
+// TargetTypeReconciliation row that carries the ledger to the wallet
+// balance; the balance itself is not changed. Chain gaps inside the ledger
+// are only reported.
+func (r *Reconciler) Run(correct, full bool) (*Report, error) {
+	r.runMu.Lock()
+	defer r.runMu.Unlock()
+
+	report := &Report{
+		RunID:         primitive.NewObjectID().Hex(),
+		StartedAt:     time.Now(),
+		Discrepancies: make([]models.LedgerDiscrepancy, 0),
+	}
+	log.Printf("🔎 Starting ledger reconciliation %s (full: %v)", report.RunID, full)
+
+	wallets, err := r.db.ListWallets()
+	if err != nil {
+		return nil, err
+	}
+	report.Wallets = len(wallets)
+
+	for i := range wallets {
+		discrepancies, skipped, err := r.checkWallet(report.RunID, &wallets[i], correct, full)
+		if err != nil {
+			log.Printf("❌ Failed to reconcile wallet of user %s: %v", wallets[i].UserID.Hex(), err)
+			report.Failed++
+			continue
+		}
+		if skipped {
+			report.Skipped++
+			continue
+		}
+
+		for j := range discrepancies {
+			if err := r.db.RecordDiscrepancy(&discrepancies[j]); err != nil {
+				log.Printf("❌ Failed to record discrepancy for user %s: %v", wallets[i].UserID.Hex(), err)
+			}
+			if !discrepancies[j].CorrectionID.IsZero() {
+				report.Corrected++
+			}
+		}
+		report.Discrepancies = append(report.Discrepancies, discrepancies...)
+	}
+
+	report.Duration = time.Since(report.StartedAt).String()
+	log.Printf("✅ Ledger reconciliation %s completed in %s - Wallets: %d, Discrepancies: %d, Corrected: %d, Skipped: %d, Failures: %d",
+		report.RunID, report.Duration, report.Wallets, len(report.Discrepancies), report.Corrected, report.Skipped, report.Failed)
+
+	r.lastMu.Lock()
+	r.lastRun = report
+	r.lastMu.Unlock()
+	return report, nil
+}
+
+// ledger returns the user's rows after the given _id (all rows if zero),
+// oldest first
+func (r *Reconciler) ledger(userID, after primitive.ObjectID) ([]models.TransactionMovement, error) {
+	rows := make([]models.TransactionMovement, 0)
+	query := database.HistoryQuery{UserID: userID, After: after, Limit: ledgerPageSize}
+	for {
+		page, err := r.db.ListTransactions(query)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, page.Transactions...)
+		if page.NextCursor.IsZero() {
+			break
+		}
+		query.Before = page.NextCursor
+	}
+
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+	return rows, nil
+}
+
+// balance reads the user's current wallet balance
+func (r *Reconciler) balance(userID primitive.ObjectID) (points.Points, error) {
+	wallet, err := r.db.GetUserWallet(userID)
+	if err != nil {
+		return 0, err
+	}
+	return database.BalanceOf(wallet)
+}
+
+// checkWallet walks the ledger chain of one wallet from its checkpoint. A
+// wallet whose balance moved while its ledger was read is skipped until the
+// next run.
+func (r *Reconciler) checkWallet(runID string, wallet *models.UserWallet, correct, full bool) ([]models.LedgerDiscrepancy, bool, error) {
+	var checkpoint *models.ReconcileCheckpoint
+	var after primitive.ObjectID
+	if !full {
+		var err error
+		if checkpoint, err = r.db.ReconcileCheckpoint(wallet.UserID); err != nil {
+			return nil, false, err
+		}
+		if checkpoint != nil {
+			after = checkpoint.TransactionID
+		}
+	}
+
+	// The balance is read right before and after the ledger, not taken from
+	// the run's wallet list, so only a write during this scan skips it
+	before, err := r.balance(wallet.UserID)
+	if err != nil {
+		return nil, false, err
+	}
+	rows, err := r.ledger(wallet.UserID, after)
+	if err != nil {
+		return nil, false, err
+	}
+	balance, err := r.balance(wallet.UserID)
+	if err != nil {
+		return nil, false, err
+	}
+	if balance != before {
+		return nil, true, nil
+	}
+
+	now := time.Now()
+	finding := func(kind string, transactionID primitive.ObjectID, expected, actual points.Points) models.LedgerDiscrepancy {
+		return models.LedgerDiscrepancy{
+			UserID:        wallet.UserID,
+			Kind:          kind,
+			TransactionID: transactionID,
+			Expected:      expected,
+			Actual:        actual,
+			RunID:         runID,
+			FirstSeen:     now,
+			LastSeen:      now,
+		}
+	}
+
+	discrepancies := make([]models.LedgerDiscrepancy, 0)
+	var ledgerBalance points.Points
+	if checkpoint != nil {
+		ledgerBalance = checkpoint.AfterAmt
+	}
+	for i, row := range rows {
+		delta := row.Amount
+		if row.TransactionType == models.TransactionTypeDebit {
+			delta = -row.Amount
+		}
+		if row.AfterAmt-row.BeforeAmt != delta {
+			discrepancies = append(discrepancies, finding(models.DiscrepancyAmountMismatch, row.ID, delta, row.AfterAmt-row.BeforeAmt))
+		}
+		// The first row may start from a balance that predates the ledger
+		if (i > 0 || checkpoint != nil) && row.BeforeAmt != ledgerBalance {
+			discrepancies = append(discrepancies, finding(models.DiscrepancyChainGap, row.ID, ledgerBalance, row.BeforeAmt))
+		}
+		ledgerBalance = row.AfterAmt
+	}
+	r.saveCheckpoint(wallet.UserID, rows, now)
+
+	if balance == ledgerBalance {
+		return discrepancies, false, nil
+	}
+
+	lastID := after
+	if len(rows) > 0 {
+		lastID = rows[len(rows)-1].ID
+	}
+	mismatch := finding(models.DiscrepancyBalanceMismatch, lastID, ledgerBalance, balance)
+	log.Printf("⚠️ Wallet of user %s holds %s but its ledger ends at %s", wallet.UserID.Hex(), balance, ledgerBalance)
+
+	if correct {
+		correction, err := r.compensate(wallet.UserID, lastID, ledgerBalance, balance)
+		if err != nil {
+			log.Printf("❌ Failed to write compensating entry for user %s: %v", wallet.UserID.Hex(), err)
+		} else if correction != nil {
+			mismatch.CorrectionID = correction.ID
+		}
+	}
+	return append(discrepancies, mismatch), false, nil
+}
+
+// saveCheckpoint moves the user's checkpoint to the newest walked row older
+// than checkpointLag. Findings up to there are already recorded, so later
+// runs start from it.
+func (r *Reconciler) saveCheckpoint(userID primitive.ObjectID, rows []models.TransactionMovement, now time.Time) {
+	for i := len(rows) - 1; i >= 0; i-- {
+		if now.Sub(rows[i].ID.Timestamp()) < checkpointLag {
+			continue
+		}
+		checkpoint := &models.ReconcileCheckpoint{
+			UserID:        userID,
+			TransactionID: rows[i].ID,
+			AfterAmt:      rows[i].AfterAmt,
+			ModifiedDate:  now,
+		}
+		if err := r.db.SaveReconcileCheckpoint(checkpoint); err != nil {
+			log.Printf("⚠️ Failed to save reconciliation checkpoint for user %s: %v", userID.Hex(), err)
+		}
+		return
+	}
+}
+
+// compensate appends a ledger row from ledgerBalance to balance. The key is
+// tied to the last row and the target, so a repeated run writes it once.
+func (r *Reconciler) compensate(userID, lastID primitive.ObjectID, ledgerBalance, balance points.Points) (*models.TransactionMovement, error) {
+	username := ""
+	if user, err := r.db.GetUserByID(userID); err == nil {
+		username = user.Username
+	}
+
+	movement := database.Movement{
+		UserID:          userID,
+		Username:        username,
+		TransactionType: models.TransactionTypeCredit,
+		TargetType:      models.TargetTypeReconciliation,
+		Amount:          balance - ledgerBalance,
+		IdempotencyKey:  fmt.Sprintf("reconcile:%s:%s:%s", userID.Hex(), lastID.Hex(), balance),
+		Remark:          fmt.Sprintf("ledger reconciliation: ledger %s, wallet %s", ledgerBalance, balance),
+		CreateBy:        "Reconciliation",
+	}
+	if movement.Amount < 0 {
+		movement.TransactionType = models.TransactionTypeDebit
+		movement.Amount = -movement.Amount
+	}
+
+	correction, err := r.db.InsertLedgerEntry(movement, balance)
+	if err == database.ErrDuplicateTransaction {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("🩹 Compensating entry %s for user %s: %s", correction.ID.Hex(), userID.Hex(), balance-ledgerBalance)
+	return correction, nil
+}
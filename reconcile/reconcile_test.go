@@ -0,0 +1,90 @@
+package reconcile
+
+import (
+	"testing"
+
+	"go-ubipay-websocket/database"
+	"go-ubipay-websocket/models"
+	"go-ubipay-websocket/points"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRunStartsFromCheckpoint(t *testing.T) {
+	db := database.NewTestDatabase()
+	userID := primitive.NewObjectID()
+
+	var rows []*models.TransactionMovement
+	for i := 0; i < 3; i++ {
+		row, err := db.AdjustBalance(userID, "alice", points.FromInt(10), "test", "ops", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+
+	// A checkpoint that disagrees with the second row shows which rows a
+	// run reads: only an incremental run chains the third row to it
+	checkpoint := &models.ReconcileCheckpoint{UserID: userID, TransactionID: rows[1].ID, AfterAmt: points.FromInt(25)}
+	if err := db.SaveReconcileCheckpoint(checkpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReconciler(db)
+	report, err := r.Run(false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Discrepancies) != 1 {
+		t.Fatalf("incremental run found %+v, want one chain gap", report.Discrepancies)
+	}
+	if d := report.Discrepancies[0]; d.Kind != models.DiscrepancyChainGap || d.TransactionID != rows[2].ID ||
+		d.Expected != points.FromInt(25) || d.Actual != points.FromInt(20) {
+		t.Errorf("finding = %+v, want a chain gap at the third row from 25", d)
+	}
+
+	// Rows younger than checkpointLag do not move the checkpoint
+	saved, err := db.ReconcileCheckpoint(userID)
+	if err != nil || saved == nil || saved.TransactionID != rows[1].ID {
+		t.Errorf("checkpoint = %+v, %v, want it left at the second row", saved, err)
+	}
+
+	report, err = r.Run(false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Discrepancies) != 0 {
+		t.Errorf("full run found %+v, want none", report.Discrepancies)
+	}
+}
+
+func TestSaveCheckpointSkipsRecentRows(t *testing.T) {
+	db := database.NewTestDatabase()
+	r := NewReconciler(db)
+	userID := primitive.NewObjectID()
+
+	first, err := db.AdjustBalance(userID, "alice", points.FromInt(10), "test", "ops", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := db.AdjustBalance(userID, "alice", points.FromInt(5), "test", "ops", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []models.TransactionMovement{*first, *second}
+	r.saveCheckpoint(userID, rows, first.ID.Timestamp().Add(checkpointLag))
+
+	saved, err := db.ReconcileCheckpoint(userID)
+	if err != nil || saved == nil {
+		t.Fatalf("checkpoint = %+v, %v", saved, err)
+	}
+	if second.ID.Timestamp().After(first.ID.Timestamp()) {
+		if saved.TransactionID != first.ID || saved.AfterAmt != points.FromInt(10) {
+			t.Errorf("checkpoint = %+v, want the first row", saved)
+		}
+	} else if saved.TransactionID != second.ID {
+		// Both rows fell in the same second, so both are old enough
+		t.Errorf("checkpoint = %+v, want the second row", saved)
+	}
+}
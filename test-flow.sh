@@ -18,6 +18,8 @@ NC='\033[0m' # No Color
 # Configuration
 SERVER_URL="http://localhost:3000"
 WS_URL="ws://localhost:3000/ws"
+# Admin endpoints are only tested when ADMIN_API_KEY is set (a key from ADMIN_API_KEYS)
+ADMIN_API_KEY="${ADMIN_API_KEY:-}"
 
 # Note: Authentication has been removed for testing
 
@@ -190,15 +192,20 @@ test_api_endpoints() {
         log_error "Health endpoint: FAILED"
     fi
     
+    if [ -z "$ADMIN_API_KEY" ]; then
+        log_warning "ADMIN_API_KEY not set, skipping admin endpoints"
+        return
+    fi
+
     # Test sessions endpoint
-    if curl -s "$SERVER_URL/admin/sessions" | grep -q '"total_sessions"'; then
+    if curl -s -H "X-Admin-Key: $ADMIN_API_KEY" "$SERVER_URL/admin/sessions" | grep -q '"total_sessions"'; then
         log_success "Sessions endpoint: OK"
     else
         log_warning "Sessions endpoint: No active sessions (expected)"
     fi
     
     # Test manual accrual
-    if curl -s -X POST "$SERVER_URL/admin/accrual/run" | grep -q '"status":"success"'; then
+    if curl -s -X POST -H "X-Admin-Key: $ADMIN_API_KEY" "$SERVER_URL/admin/accrual/run" | grep -q '"status":"success"'; then
         log_success "Manual accrual endpoint: OK"
     else
         log_error "Manual accrual endpoint: FAILED"
@@ -0,0 +1,74 @@
+package websocket
+
+import (
+	"log"
+	"time"
+
+	"go-ubipay-websocket/accrual"
+	"go-ubipay-websocket/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Campaign announcements
+const (
+	CampaignStarted = "campaign_started"
+	CampaignEnded   = "campaign_ended"
+)
+
+// AnnounceCampaign sends a campaign_started or campaign_ended message to every
+// connection the campaign targets and returns how many were notified. Guests
+// only hear about campaigns open to everyone.
+func (h *WebSocketHandler) AnnounceCampaign(event string, campaign models.Campaign) int {
+	tiers := make(map[primitive.ObjectID]accrual.Tier)
+	notified := 0
+	for _, session := range h.sessionManager.GetActiveSessions() {
+		if !h.campaignTargets(session, campaign, tiers) {
+			continue
+		}
+		if err := session.Send(WSMessage{Type: event, Payload: campaignPayload(campaign)}); err != nil {
+			log.Printf("❌ Failed to send %s to user %s: %v", event, session.Info().Username, err)
+			continue
+		}
+		notified++
+	}
+	return notified
+}
+
+// announceCampaigns tells a newly connected session about the campaigns
+// running for it
+func (h *WebSocketHandler) announceCampaigns(session *Session) {
+	tiers := make(map[primitive.ObjectID]accrual.Tier)
+	for _, campaign := range h.accruer.ActiveCampaigns(time.Now()) {
+		if h.campaignTargets(session, campaign, tiers) {
+			session.Send(WSMessage{Type: CampaignStarted, Payload: campaignPayload(campaign)})
+		}
+	}
+}
+
+// campaignTargets reports whether the campaign applies to the session's
+// user; tiers caches the lookups of one announcement
+func (h *WebSocketHandler) campaignTargets(session *Session, campaign models.Campaign, tiers map[primitive.ObjectID]accrual.Tier) bool {
+	info := session.Info()
+	if info.Guest {
+		return len(campaign.UserVips) == 0 && len(campaign.UserIDs) == 0
+	}
+	tier, cached := tiers[info.UserID]
+	if !cached {
+		_, _, tier, _ = h.sessionManager.AccrualState(info.UserID)
+		tiers[info.UserID] = tier
+	}
+	return accrual.Targets(campaign, info.UserID, tier.UserVip)
+}
+
+func campaignPayload(campaign models.Campaign) fiber.Map {
+	return fiber.Map{
+		"campaign_id": campaign.ID.Hex(),
+		"name":        campaign.Name,
+		"multiplier":  campaign.Multiplier,
+		"start_at":    campaign.StartAt,
+		"end_at":      campaign.EndAt,
+		"timestamp":   time.Now().Unix(),
+	}
+}
@@ -0,0 +1,66 @@
+package websocket
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CloseTerminated: an administrator closed the connection or the user is banned
+const CloseTerminated = 4005
+
+// DisconnectUser closes every connection of the user and returns how many
+// were open. With settle the time since the last accrual tick is credited,
+// otherwise it is forfeited.
+func (h *WebSocketHandler) DisconnectUser(userID primitive.ObjectID, reason string, settle bool) int {
+	sessions, user := h.sessionManager.RemoveUser(userID)
+	for _, session := range sessions {
+		h.terminate(session, reason)
+	}
+	if user != nil {
+		h.finishDisconnect(user, settle)
+	}
+	return len(sessions)
+}
+
+// DisconnectConnection closes one connection of the user. Accrual is only
+// settled (or forfeited) when it was the user's last connection.
+func (h *WebSocketHandler) DisconnectConnection(userID primitive.ObjectID, connID, reason string, settle bool) bool {
+	session, exists := h.sessionManager.GetSession(connID)
+	if !exists || session.Info().UserID != userID {
+		return false
+	}
+
+	session, user := h.sessionManager.RemoveSession(connID)
+	if session == nil {
+		return false
+	}
+	h.terminate(session, reason)
+	if user != nil {
+		h.finishDisconnect(user, settle)
+	}
+	return true
+}
+
+func (h *WebSocketHandler) finishDisconnect(user *UserSessions, settle bool) {
+	if user.Guest {
+		return
+	}
+	if !settle {
+		log.Printf("✂️ Pending accrual of user %s forfeited on admin disconnect", user.Username)
+		return
+	}
+	h.settleUser(user, "admin disconnect")
+}
+
+func (h *WebSocketHandler) terminate(session *Session, reason string) {
+	info := session.Info()
+	log.Printf("⛔ Terminating session %s of user %s (%s): %s", session.ConnID, info.Username, info.UserID.Hex(), reason)
+	session.Send(WSMessage{
+		Type:    "session_terminated",
+		Payload: fiber.Map{"reason": reason},
+	})
+	session.Close(CloseTerminated, reason)
+}
@@ -1,17 +1,21 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
-	"github.com/golang-jwt/jwt/v4"
 
+	"go-ubipay-websocket/accrual"
+	"go-ubipay-websocket/auth"
 	"go-ubipay-websocket/config"
 	"go-ubipay-websocket/database"
+	"go-ubipay-websocket/models"
+	"go-ubipay-websocket/points"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -19,7 +23,12 @@ import (
 type WebSocketHandler struct {
 	cfg            *config.Config
 	sessionManager *SessionManager
-	db             *database.Database
+	db             database.Store
+	accruer        *accrual.Accruer
+	authenticator  auth.Authenticator
+	reaperStop     chan struct{}
+
+	revalidateCancel context.CancelFunc
 }
 
 type WSMessage struct {
@@ -31,20 +40,92 @@ type HeartbeatMessage struct {
 	Timestamp int64 `json:"timestamp"`
 }
 
-func NewWebSocketHandler(cfg *config.Config, sessionManager *SessionManager, db *database.Database) *WebSocketHandler {
+func NewWebSocketHandler(cfg *config.Config, sessionManager *SessionManager, db database.Store, accruer *accrual.Accruer, authenticator auth.Authenticator) *WebSocketHandler {
 	return &WebSocketHandler{
 		cfg:            cfg,
 		sessionManager: sessionManager,
 		db:             db,
+		accruer:        accruer,
+		authenticator:  authenticator,
+	}
+}
+
+// Authentication modes for WebSocket upgrades without a token
+const (
+	// AuthModeRequired rejects the upgrade with 401
+	AuthModeRequired = "required"
+	// AuthModeOptionalGuest accepts a guest session that does not accrue
+	// points until it authenticates in-band
+	AuthModeOptionalGuest = "optional-guest"
+	// AuthModeDevFixedUser maps every anonymous client to one shared test
+	// user; local development only
+	AuthModeDevFixedUser = "dev-fixed-user"
+)
+
+const (
+	devFixedUserID   = "507f1f77bcf86cd799439011"
+	devFixedUsername = "testuser@example.com"
+)
+
+// Fiber locals set by HandleWebSocket for WebSocketConnection
+const (
+	localUserID   = "userID"
+	localUsername = "username"
+	localGuest    = "guest"
+	localToken    = "token"
+)
+
+// requestToken returns the token from the "token" query parameter or an
+// "Authorization: Bearer" header
+func requestToken(c *fiber.Ctx) string {
+	if token := c.Query("token"); token != "" {
+		return token
+	}
+	if auth := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
 	}
+	return ""
 }
 
+// HandleWebSocket authenticates the upgrade request before the socket is
+// accepted, so unauthenticated clients get a plain HTTP 401
 func (h *WebSocketHandler) HandleWebSocket(c *fiber.Ctx) error {
-	if websocket.IsWebSocketUpgrade(c) {
-		c.Locals("allowed", true)
-		return c.Next()
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+
+	if token := requestToken(c); token != "" {
+		identity, err := h.validateToken(token)
+		if err != nil {
+			log.Printf("❌ WebSocket upgrade rejected: %v", err)
+			return fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired token")
+		}
+		c.Locals(localUserID, identity.UserID)
+		c.Locals(localUsername, identity.Username)
+		c.Locals(localToken, token)
+	} else {
+		switch h.cfg.AuthMode {
+		case AuthModeOptionalGuest:
+			c.Locals(localGuest, true)
+			c.Locals(localUserID, primitive.NewObjectID())
+			c.Locals(localUsername, "guest")
+		case AuthModeDevFixedUser:
+			userID, _ := primitive.ObjectIDFromHex(devFixedUserID)
+			c.Locals(localUserID, userID)
+			c.Locals(localUsername, devFixedUsername)
+		default:
+			return fiber.NewError(fiber.StatusUnauthorized, "Authentication required")
+		}
 	}
-	return fiber.ErrUpgradeRequired
+
+	if userID, ok := c.Locals(localUserID).(primitive.ObjectID); ok {
+		if until, banned := h.sessionManager.BannedUntil(userID); banned {
+			return fiber.NewError(fiber.StatusForbidden, "Banned until "+until.UTC().Format(time.RFC3339))
+		}
+	}
+
+	c.Locals("allowed", true)
+	return c.Next()
 }
 
 func (h *WebSocketHandler) WebSocketConnection(c *websocket.Conn) {
@@ -54,89 +135,238 @@ func (h *WebSocketHandler) WebSocketConnection(c *websocket.Conn) {
 		}
 	}()
 
-	// Extract token from query parameters
-	token := c.Query("token")
-	var userID primitive.ObjectID
-	var username string
-	fmt.Println("token:", token)
+	// Identity was resolved by HandleWebSocket before the upgrade
+	userID, _ := c.Locals(localUserID).(primitive.ObjectID)
+	username, _ := c.Locals(localUsername).(string)
+	guest, _ := c.Locals(localGuest).(bool)
+	token, _ := c.Locals(localToken).(string)
+	if userID.IsZero() {
+		closeConn(c, websocket.ClosePolicyViolation, "not authenticated")
+		return
+	}
 
-	if token != "" {
-		// Validate JWT token
-		authenticatedUserID, authenticatedUsername, err := h.validateSessionToken(token)
-		if err != nil {
-			log.Printf("❌ JWT validation failed: %v", err)
-			c.WriteJSON(WSMessage{
-				Type:    "auth_failed",
-				Payload: "Invalid or expired token",
-			})
-			c.Close()
-			return
-		}
-		userID = authenticatedUserID
-		username = authenticatedUsername
-		log.Printf("🔌 WebSocket connection established for authenticated user: %s (%s)", username, userID.Hex())
+	if guest {
+		log.Printf("🔌 WebSocket connection established for guest (%s)", userID.Hex())
 	} else {
-		// Use mock user data for testing when no token provided
-		userID, _ = primitive.ObjectIDFromHex("507f1f77bcf86cd799439011")
-		username = "testuser@example.com"
-		log.Printf("🔌 WebSocket connection established for test user: %s (%s)", username, userID.Hex())
+		log.Printf("🔌 WebSocket connection established for user: %s (%s)", username, userID.Hex())
 	}
 
 	// Add session to manager
-	session := h.sessionManager.AddSession(userID, username, c)
-	defer h.sessionManager.RemoveSession(userID)
-
-	// Ensure user wallet exists in database
-	_, err := h.db.GetUserWallet(userID)
+	session, kicked, err := h.sessionManager.AddSession(userID, username, guest, token, c)
+	if err == ErrUserBanned {
+		c.WriteJSON(WSMessage{
+			Type:    "connection_rejected",
+			Payload: "User is banned",
+		})
+		closeConn(c, CloseTerminated, "banned")
+		return
+	}
 	if err != nil {
+		c.WriteJSON(WSMessage{
+			Type:    "connection_rejected",
+			Payload: "Too many connections for this user",
+		})
+		closeConn(c, CloseTooManyConnections, "too many connections")
+		return
+	}
+	defer h.closeSession(session.ConnID)
+
+	h.replaceSessions(kicked)
+
+	// Ensure user wallet exists in database; guests have none
+	if !guest {
+		h.ensureWallet(userID, username)
+		h.RefreshTier(userID)
+	}
+
+	// Send initial connection success message
+	session.Send(WSMessage{
+		Type:    "connected",
+		Payload: fiber.Map{"user_id": userID.Hex(), "username": username, "guest": guest},
+	})
+	h.announceCampaigns(session)
+
+	done := make(chan struct{})
+	defer close(done)
+	go h.writeLoop(session, done)
+
+	h.readLoop(session)
+}
+
+// RefreshTier caches the user's tier and its accrual rate on its sessions.
+// The accrual job calls it for every user it credits, so tier changes apply
+// whatever the revalidation settings. A user without a TblUser record (JWT only) is treated as type 0, VIP 0;
+// on lookup errors the cached tier is kept.
+func (h *WebSocketHandler) RefreshTier(userID primitive.ObjectID) {
+	var userType, userVip int
+	user, err := h.db.GetUserByID(userID)
+	switch err {
+	case nil:
+		userType, userVip = user.UserType, user.UserVip
+	case database.ErrUserNotFound:
+	default:
+		log.Printf("⚠️ Could not look up tier of user %s: %v", userID.Hex(), err)
+		return
+	}
+
+	tier := accrual.Tier{Rate: h.accruer.Rate(userType, userVip), UserVip: userVip}
+	previous, exists := h.sessionManager.SetTier(userID, tier)
+	if exists && previous.Rate != tier.Rate {
+		log.Printf("🏅 Accrual rate of user %s (type %d, VIP %d): %sx → %sx", userID.Hex(), userType, userVip, previous.Rate, tier.Rate)
+	}
+}
+
+// RefreshRates re-applies the rate table to every connected user
+func (h *WebSocketHandler) RefreshRates() {
+	for _, user := range h.sessionManager.GetActiveUsers() {
+		h.RefreshTier(user.UserID)
+	}
+}
+
+// replaceSessions closes connections that were pushed out by a newer one
+func (h *WebSocketHandler) replaceSessions(kicked []*Session) {
+	for _, old := range kicked {
+		old.Send(WSMessage{
+			Type:    "session_replaced",
+			Payload: fiber.Map{"reason": "A newer connection was opened for this user"},
+		})
+		old.Close(CloseConnectionReplaced, "replaced by newer connection")
+	}
+}
+
+func (h *WebSocketHandler) ensureWallet(userID primitive.ObjectID, username string) {
+	if _, err := h.db.GetUserWallet(userID); err != nil {
 		// Create wallet if it doesn't exist
-		_, err := h.db.CreateUserWallet(userID)
-		if err != nil {
+		if _, err := h.db.CreateUserWallet(userID); err != nil {
 			log.Printf("❌ Failed to create wallet for user %s: %v", username, err)
 		}
 	}
+}
 
-	// Send initial connection success message
-	c.WriteJSON(WSMessage{
-		Type:    "connected",
-		Payload: fiber.Map{"user_id": userID.Hex(), "username": username},
+// pongWait is how long the connection may stay silent (no message and no
+// pong) before the read deadline expires
+func (h *WebSocketHandler) pongWait() time.Duration {
+	return h.heartbeatTimeout() + writeWait
+}
+
+// heartbeatTimeout is how long a client may stay silent; at least one
+// heartbeat interval whatever HEARTBEAT_MAX_MISSED says
+func (h *WebSocketHandler) heartbeatTimeout() time.Duration {
+	missed := h.cfg.HeartbeatMaxMissed
+	if missed < 1 {
+		missed = 1
+	}
+	return h.cfg.HeartbeatInterval * time.Duration(missed)
+}
+
+// readLoop blocks reading client messages until the connection fails or
+// closes. Any frame, including a pong, pushes the read deadline forward.
+func (h *WebSocketHandler) readLoop(session *Session) {
+	c := session.Conn
+	c.SetReadDeadline(time.Now().Add(h.pongWait()))
+	c.SetPongHandler(func(string) error {
+		return c.SetReadDeadline(time.Now().Add(h.pongWait()))
 	})
 
-	// Start heartbeat ticker
+	for {
+		messageType, msg, err := c.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("❌ WebSocket read error for user %s: %v", session.Username, err)
+			}
+			return
+		}
+		c.SetReadDeadline(time.Now().Add(h.pongWait()))
+
+		if messageType == websocket.TextMessage {
+			h.handleMessage(session, msg)
+		}
+	}
+}
+
+// writeLoop is the only goroutine that writes data frames to the socket. It
+// drains the session's outbound queue and sends the JSON heartbeat and a
+// protocol-level ping every HeartbeatInterval, independent of client traffic.
+func (h *WebSocketHandler) writeLoop(session *Session, done <-chan struct{}) {
 	heartbeatTicker := time.NewTicker(h.cfg.HeartbeatInterval)
 	defer heartbeatTicker.Stop()
 
-	// Message handling loop
 	for {
 		select {
+		case <-done:
+			return
+
+		case item := <-session.send:
+			if item.closeCode != 0 {
+				closeConn(session.Conn, item.closeCode, item.reason)
+				return
+			}
+			if err := session.writeMessage(item.msg); err != nil {
+				log.Printf("❌ Failed to write to user %s: %v", session.Info().Username, err)
+				// Unblock the read loop so the session is torn down
+				session.Conn.Close()
+				return
+			}
+
 		case <-heartbeatTicker.C:
-			// Send heartbeat ping
-			err := c.WriteJSON(WSMessage{
+			err := session.writeMessage(WSMessage{
 				Type:    "heartbeat",
 				Payload: HeartbeatMessage{Timestamp: time.Now().Unix()},
 			})
-			if err != nil {
-				log.Printf("❌ Failed to send heartbeat to user %s: %v", username, err)
-				return
+			if err == nil {
+				err = session.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
 			}
-
-		default:
-			// Read incoming messages
-			messageType, msg, err := c.ReadMessage()
 			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					log.Printf("❌ WebSocket read error for user %s: %v", username, err)
-				}
+				log.Printf("❌ Failed to send heartbeat to user %s: %v", session.Info().Username, err)
+				session.Conn.Close()
 				return
 			}
-
-			if messageType == websocket.TextMessage {
-				h.handleMessage(session, msg)
-			}
 		}
 	}
 }
 
+// closeSession removes the connection. If it was the user's last one, the
+// time connected since the last accrual tick is settled.
+func (h *WebSocketHandler) closeSession(connID string) {
+	_, user := h.sessionManager.RemoveSession(connID)
+	if user == nil || user.Guest {
+		return
+	}
+	h.settleUser(user, "disconnect")
+}
+
+// settleUser credits the time since the user's last accrual tick once its
+// last connection is gone
+func (h *WebSocketHandler) settleUser(user *UserSessions, reason string) {
+	// A timed out client stopped earning at its last heartbeat
+	end := time.Now()
+	if user.TimedOut {
+		end = user.LastHeartbeat
+	}
+
+	// Wait for an accrual run that is crediting this user; it moves the
+	// window start past what it credited
+	user.accrualMu.Lock()
+	defer user.accrualMu.Unlock()
+	from, carry, tier := h.sessionManager.AccrualStateOf(user)
+
+	result, err := h.accruer.Settle(user.UserID, user.Username, from, end, carry, tier)
+	if err == database.ErrDuplicateTransaction {
+		log.Printf("⏭️ Final accrual window of user %s from %s was already credited", user.Username, from.Format("2006-01-02 15:04:05"))
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to settle final accrual for user %s: %v", user.Username, err)
+		return
+	}
+	if result.Points > 0 {
+		log.Printf("🧾 Final accrual for user %s on %s: %s points", user.Username, reason, result.Points)
+	}
+	for _, bonus := range result.Referrals {
+		h.BroadcastBalanceUpdate(bonus.UserID, bonus.AfterAmt)
+	}
+}
+
 func (h *WebSocketHandler) handleMessage(session *Session, msg []byte) {
 	var wsMsg WSMessage
 	if err := json.Unmarshal(msg, &wsMsg); err != nil {
@@ -161,7 +391,7 @@ func (h *WebSocketHandler) handleMessage(session *Session, msg []byte) {
 
 	switch wsMsg.Type {
 	case "heartbeat":
-		h.sessionManager.UpdateHeartbeat(session.UserID)
+		h.sessionManager.UpdateHeartbeat(session.ConnID)
 		log.Printf("💓 Heartbeat received from user: %s", session.Username)
 
 	case "auth":
@@ -170,50 +400,73 @@ func (h *WebSocketHandler) handleMessage(session *Session, msg []byte) {
 	case "balance_request":
 		h.handleBalanceRequest(session)
 
+	case "history_request":
+		h.handleHistoryRequest(session, wsMsg.Payload)
+
 	default:
 		log.Printf("⚠️ Unknown message type from user %s: %s", session.Username, wsMsg.Type)
 	}
 }
 
 func (h *WebSocketHandler) handleBalanceRequest(session *Session) {
+	if session.Guest {
+		session.Send(WSMessage{
+			Type:    "error",
+			Payload: "Authentication required",
+		})
+		return
+	}
+
 	wallet, err := h.db.GetUserWallet(session.UserID)
+	var balance points.Points
+	if err == nil {
+		balance, err = database.BalanceOf(wallet)
+	}
 	if err != nil {
 		log.Printf("❌ Failed to get wallet for user %s: %v", session.Username, err)
-		session.Conn.WriteJSON(WSMessage{
+		session.Send(WSMessage{
 			Type:    "error",
 			Payload: "Failed to retrieve balance",
 		})
 		return
 	}
-	log.Printf("💳 Balance request for user %s - Real balance: %d", session.Username, wallet.Balance)
+	log.Printf("💳 Balance request for user %s - Real balance: %s", session.Username, balance)
+
+	payload := fiber.Map{"balance": balance}
+	// Remaining accrual allowance, only when caps are configured
+	if allowance, err := h.accruer.Allowance(session.UserID); err != nil {
+		log.Printf("⚠️ Failed to get accrual allowance for user %s: %v", session.Username, err)
+	} else if allowance != nil {
+		payload["allowance"] = allowance
+	}
 
-	session.Conn.WriteJSON(WSMessage{
+	session.Send(WSMessage{
 		Type:    "balance",
-		Payload: fiber.Map{"balance": wallet.Balance},
+		Payload: payload,
 	})
 
-	log.Printf("💰 Balance sent to user: %s - %d points", session.Username, wallet.Balance)
+	log.Printf("💰 Balance sent to user: %s - %s points", session.Username, balance)
 }
 
-func (h *WebSocketHandler) SendAccrualNotification(session *Session, points int, newBalance int) {
-	err := session.Conn.WriteJSON(WSMessage{
+func (h *WebSocketHandler) SendAccrualNotification(session *Session, earned, newBalance points.Points) {
+	err := session.Send(WSMessage{
 		Type: "accrual",
 		Payload: fiber.Map{
-			"points":      points,
+			"points":      earned,
 			"new_balance": newBalance,
 			"timestamp":   time.Now().Unix(),
 		},
 	})
 	if err != nil {
-		log.Printf("❌ Failed to send accrual notification to user %s: %v", session.Username, err)
+		log.Printf("❌ Failed to send accrual notification to user %s: %v", session.Info().Username, err)
 	} else {
-		log.Printf("📢 Accrual notification sent to user %s: +%d points, new balance: %d",
-			session.Username, points, newBalance)
+		log.Printf("📢 Accrual notification sent to user %s: +%s points, new balance: %s",
+			session.Info().Username, earned, newBalance)
 	}
 }
 
-func (h *WebSocketHandler) SendBalanceUpdate(session *Session, balance int) {
-	err := session.Conn.WriteJSON(WSMessage{
+func (h *WebSocketHandler) SendBalanceUpdate(session *Session, balance points.Points) {
+	err := session.Send(WSMessage{
 		Type: "balance_update",
 		Payload: fiber.Map{
 			"balance":   balance,
@@ -221,37 +474,56 @@ func (h *WebSocketHandler) SendBalanceUpdate(session *Session, balance int) {
 		},
 	})
 	if err != nil {
-		log.Printf("❌ Failed to send balance update to user %s: %v", session.Username, err)
+		log.Printf("❌ Failed to send balance update to user %s: %v", session.Info().Username, err)
 	} else {
-		log.Printf("💳 Balance update sent to user %s: %d points", session.Username, balance)
+		log.Printf("💳 Balance update sent to user %s: %s points", session.Info().Username, balance)
 	}
 }
 
-func (h *WebSocketHandler) validateSessionToken(sessionToken string) (primitive.ObjectID, string, error) {
-	// Use database to validate session token
-	user, err := h.db.GetUserBySessionToken(sessionToken)
+// SendCapReached tells the user that accrual stops until the given caps reset
+func (h *WebSocketHandler) SendCapReached(session *Session, exhausted []database.CapUsage) {
+	err := session.Send(WSMessage{
+		Type: "cap_reached",
+		Payload: fiber.Map{
+			"caps":      exhausted,
+			"timestamp": time.Now().Unix(),
+		},
+	})
 	if err != nil {
-		log.Printf("❌ Session token validation failed: %v", err)
-		return primitive.NilObjectID, "", err
+		log.Printf("❌ Failed to send cap notification to user %s: %v", session.Info().Username, err)
+	} else {
+		log.Printf("⛔ Cap notification sent to user %s", session.Info().Username)
 	}
+}
 
-	// Check if user is enabled
-	if !user.Enable {
-		log.Printf("❌ User account is disabled: %s", user.Username)
-		return primitive.NilObjectID, "", jwt.ErrInvalidKey
+// BroadcastBalanceUpdate pushes the balance to every open connection of the
+// user and returns how many were notified
+func (h *WebSocketHandler) BroadcastBalanceUpdate(userID primitive.ObjectID, balance points.Points) int {
+	sessions := h.sessionManager.GetUserSessions(userID)
+	for _, session := range sessions {
+		h.SendBalanceUpdate(session, balance)
 	}
+	return len(sessions)
+}
 
-	// Return user information
-	return user.ID, user.Username, nil
+// validateToken checks a bearer token with the configured authenticators
+// (signed JWT and/or TblUser.SessionToken lookup)
+func (h *WebSocketHandler) validateToken(token string) (*models.AuthToken, error) {
+	identity, err := h.authenticator.Authenticate(token)
+	if err != nil {
+		log.Printf("❌ Token validation failed: %v", err)
+		return nil, err
+	}
+	return identity, nil
 }
 
+// handleAuthMessage authenticates the connection in-band. A guest or
+// dev-fixed-user connection is moved to the token's identity; an
+// authenticated connection may only re-send a token for the same user.
 func (h *WebSocketHandler) handleAuthMessage(session *Session, payload interface{}) {
-	// Extract token from payload
-	fmt.Printf("DEBUG payload type: %T, value: %#v\n", payload, payload)
-
 	payloadMap, ok := payload.(map[string]interface{})
 	if !ok {
-		session.Conn.WriteJSON(WSMessage{
+		session.Send(WSMessage{
 			Type:    "auth_failed",
 			Payload: "Invalid auth message format",
 		})
@@ -260,32 +532,64 @@ func (h *WebSocketHandler) handleAuthMessage(session *Session, payload interface
 
 	token, ok := payloadMap["token"].(string)
 	if !ok || token == "" {
-		session.Conn.WriteJSON(WSMessage{
+		session.Send(WSMessage{
 			Type:    "auth_failed",
 			Payload: "Token is required",
 		})
 		return
 	}
 
-	// Validate JWT token
-	userID, username, err := h.validateSessionToken(token)
+	identity, err := h.validateToken(token)
 	if err != nil {
 		log.Printf("❌ Auth message validation failed: %v", err)
-		session.Conn.WriteJSON(WSMessage{
+		session.Send(WSMessage{
 			Type:    "auth_failed",
 			Payload: "Invalid or expired token",
 		})
 		return
 	}
 
-	// Update session with authenticated user data
-	session.UserID = userID
-	session.Username = username
+	userID, username := identity.UserID, identity.Username
+
+	settle, kicked, err := h.sessionManager.AuthenticateSession(session.ConnID, userID, username, token)
+	switch err {
+	case nil:
+	case ErrAlreadyAuthenticated:
+		log.Printf("⛔ Session %s already authenticated as %s, rejecting auth as %s", session.ConnID, session.Username, username)
+		session.Send(WSMessage{
+			Type:    "auth_failed",
+			Payload: "Session is already authenticated as another user",
+		})
+		return
+	case ErrTooManyConnections:
+		session.Send(WSMessage{
+			Type:    "auth_failed",
+			Payload: "Too many connections for this user",
+		})
+		return
+	case ErrUserBanned:
+		session.Send(WSMessage{
+			Type:    "auth_failed",
+			Payload: "User is banned",
+		})
+		return
+	default:
+		log.Printf("❌ Failed to authenticate session %s: %v", session.ConnID, err)
+		return
+	}
+
+	h.replaceSessions(kicked)
+	if settle != nil {
+		h.settleUser(settle, "re-authentication")
+	}
+	h.ensureWallet(userID, username)
+	h.RefreshTier(userID)
+
 	log.Printf("✅ Authentication successful for user: %s (%s)", username, userID.Hex())
 
-	// Send authentication success message
-	session.Conn.WriteJSON(WSMessage{
+	session.Send(WSMessage{
 		Type:    "auth_success",
 		Payload: fiber.Map{"user_id": userID.Hex(), "username": username},
 	})
+	h.announceCampaigns(session)
 }
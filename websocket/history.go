@@ -0,0 +1,162 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"go-ubipay-websocket/database"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+// historyRequest is the filter sent as REST query parameters or as the
+// payload of a history_request message. Dates are RFC 3339.
+type historyRequest struct {
+	RequestID       string `json:"request_id" query:"request_id"`
+	From            string `json:"from" query:"from"`
+	To              string `json:"to" query:"to"`
+	TransactionType int    `json:"transaction_type" query:"transaction_type"`
+	TargetType      int    `json:"target_type" query:"target_type"`
+	Cursor          string `json:"cursor" query:"cursor"`
+	Limit           int    `json:"limit" query:"limit"`
+}
+
+func (r historyRequest) query(userID primitive.ObjectID) (database.HistoryQuery, error) {
+	query := database.HistoryQuery{
+		UserID:          userID,
+		TransactionType: r.TransactionType,
+		TargetType:      r.TargetType,
+		Limit:           r.Limit,
+	}
+
+	if query.Limit <= 0 {
+		query.Limit = defaultHistoryLimit
+	}
+	if query.Limit > maxHistoryLimit {
+		query.Limit = maxHistoryLimit
+	}
+
+	var err error
+	if r.From != "" {
+		if query.From, err = time.Parse(time.RFC3339, r.From); err != nil {
+			return query, fmt.Errorf("invalid from %q, expected RFC 3339", r.From)
+		}
+	}
+	if r.To != "" {
+		if query.To, err = time.Parse(time.RFC3339, r.To); err != nil {
+			return query, fmt.Errorf("invalid to %q, expected RFC 3339", r.To)
+		}
+	}
+	if r.Cursor != "" {
+		if query.Before, err = primitive.ObjectIDFromHex(r.Cursor); err != nil {
+			return query, fmt.Errorf("invalid cursor %q", r.Cursor)
+		}
+	}
+	return query, nil
+}
+
+func historyResponse(requestID string, page *database.HistoryPage) fiber.Map {
+	nextCursor := ""
+	if !page.NextCursor.IsZero() {
+		nextCursor = page.NextCursor.Hex()
+	}
+	response := fiber.Map{
+		"transactions": page.Transactions,
+		"next_cursor":  nextCursor,
+		"has_more":     nextCursor != "",
+	}
+	if requestID != "" {
+		response["request_id"] = requestID
+	}
+	return response
+}
+
+// HandleHistory serves the caller's own ledger; the token is passed like
+// for the WebSocket upgrade
+func (h *WebSocketHandler) HandleHistory(c *fiber.Ctx) error {
+	token := requestToken(c)
+	if token == "" {
+		return fiber.NewError(fiber.StatusUnauthorized, "Authentication required")
+	}
+	identity, err := h.validateToken(token)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired token")
+	}
+	return h.ServeHistory(c, identity.UserID)
+}
+
+// ServeHistory writes one page of userID's ledger filtered by the request's
+// query parameters
+func (h *WebSocketHandler) ServeHistory(c *fiber.Ctx, userID primitive.ObjectID) error {
+	var req historyRequest
+	if err := c.QueryParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid query parameters")
+	}
+	query, err := req.query(userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	page, err := h.db.ListTransactions(query)
+	if err != nil {
+		log.Printf("❌ Failed to list transactions for user %s: %v", userID.Hex(), err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve transactions")
+	}
+	return c.JSON(historyResponse(req.RequestID, page))
+}
+
+func (h *WebSocketHandler) handleHistoryRequest(session *Session, payload interface{}) {
+	if session.Guest {
+		session.Send(WSMessage{
+			Type:    "error",
+			Payload: "Authentication required",
+		})
+		return
+	}
+
+	// Payload arrives as a generic map; round-trip it into the request struct
+	var req historyRequest
+	if payload != nil {
+		raw, _ := json.Marshal(payload)
+		if err := json.Unmarshal(raw, &req); err != nil {
+			session.Send(WSMessage{
+				Type:    "error",
+				Payload: "Invalid history request",
+			})
+			return
+		}
+	}
+
+	query, err := req.query(session.UserID)
+	if err != nil {
+		session.Send(WSMessage{
+			Type:    "error",
+			Payload: err.Error(),
+		})
+		return
+	}
+
+	page, err := h.db.ListTransactions(query)
+	if err != nil {
+		log.Printf("❌ Failed to list transactions for user %s: %v", session.Username, err)
+		session.Send(WSMessage{
+			Type:    "error",
+			Payload: "Failed to retrieve transactions",
+		})
+		return
+	}
+
+	session.Send(WSMessage{
+		Type:    "history",
+		Payload: historyResponse(req.RequestID, page),
+	})
+}
@@ -0,0 +1,109 @@
+package websocket
+
+import (
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+// Slow consumer policies for a full outbound queue
+const (
+	QueuePolicyDropOldest = "drop-oldest"
+	QueuePolicyDisconnect = "disconnect"
+)
+
+// writeWait is the time allowed to write a single message to the client
+const writeWait = 10 * time.Second
+
+var (
+	ErrSessionClosed = errors.New("session closed")
+	ErrSlowConsumer  = errors.New("outbound queue full, slow consumer disconnected")
+)
+
+// outboundMessage is an entry in a session's send queue. A non-zero
+// closeCode closes the connection once everything queued before it is written.
+type outboundMessage struct {
+	msg       WSMessage
+	closeCode int
+	reason    string
+}
+
+// Send queues a JSON message for the session's writer goroutine. It never
+// blocks; a full queue is handled according to the session's queue policy.
+func (s *Session) Send(msg WSMessage) error {
+	return s.enqueue(outboundMessage{msg: msg})
+}
+
+// Close queues a close frame behind any pending messages
+func (s *Session) Close(code int, reason string) {
+	s.enqueue(outboundMessage{closeCode: code, reason: reason})
+}
+
+func (s *Session) enqueue(item outboundMessage) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	if s.closed {
+		return ErrSessionClosed
+	}
+	if item.closeCode != 0 {
+		s.closed = true
+	}
+
+	select {
+	case s.send <- item:
+		return nil
+	default:
+	}
+
+	if item.closeCode != 0 {
+		// No room to queue the close frame behind pending messages
+		closeConn(s.Conn, item.closeCode, item.reason)
+		return nil
+	}
+
+	if s.queuePolicy == QueuePolicyDisconnect {
+		s.closed = true
+		log.Printf("⚠️ Outbound queue full for user %s, disconnecting slow consumer", s.Info().Username)
+		closeConn(s.Conn, websocket.ClosePolicyViolation, "slow consumer")
+		return ErrSlowConsumer
+	}
+
+	// Drop the oldest message to make room; only senders push and they hold
+	// sendMu, so there is space afterwards
+	select {
+	case <-s.send:
+		atomic.AddUint64(&s.dropped, 1)
+	default:
+	}
+	s.send <- item
+	return nil
+}
+
+// QueueDepth returns the number of messages waiting to be written
+func (s *Session) QueueDepth() int {
+	return len(s.send)
+}
+
+// DroppedMessages returns how many messages were discarded by the
+// drop-oldest policy
+func (s *Session) DroppedMessages() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// writeMessage writes a single message; only the writer goroutine calls it
+func (s *Session) writeMessage(msg WSMessage) error {
+	s.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return s.Conn.WriteJSON(msg)
+}
+
+// closeConn sends a close frame with the given code and closes the socket.
+// The connection's read loop then exits and settles the session.
+func closeConn(conn *websocket.Conn, code int, reason string) {
+	deadline := time.Now().Add(time.Second)
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+	conn.Close()
+}
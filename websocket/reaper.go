@@ -0,0 +1,89 @@
+package websocket
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Application close codes sent to clients
+const (
+	// CloseHeartbeatTimeout: the client stopped answering heartbeats
+	CloseHeartbeatTimeout = 4000
+	// CloseConnectionReplaced: a newer connection of the same user took over
+	CloseConnectionReplaced = 4001
+	// CloseTooManyConnections: the user already has the maximum number of connections
+	CloseTooManyConnections = 4002
+	// CloseAuthTimeout: a guest connection did not authenticate in time
+	CloseAuthTimeout = 4003
+)
+
+// StartReaper periodically disconnects sessions that missed
+// cfg.HeartbeatMaxMissed heartbeats in a row, and guest sessions that did
+// not authenticate within cfg.AuthTimeout
+func (h *WebSocketHandler) StartReaper() {
+	if h.cfg.HeartbeatInterval <= 0 {
+		log.Fatalf("❌ Invalid HEARTBEAT_INTERVAL: %v", h.cfg.HeartbeatInterval)
+	}
+	if h.cfg.SessionReapInterval <= 0 {
+		log.Fatalf("❌ Invalid SESSION_REAP_INTERVAL: %v", h.cfg.SessionReapInterval)
+	}
+	if h.cfg.HeartbeatMaxMissed < 1 {
+		log.Printf("⚠️ HEARTBEAT_MAX_MISSED=%d, using 1", h.cfg.HeartbeatMaxMissed)
+	}
+
+	timeout := h.heartbeatTimeout()
+	h.reaperStop = make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(h.cfg.SessionReapInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-h.reaperStop:
+				return
+			case <-ticker.C:
+				h.reapInactiveSessions(timeout)
+				h.reapUnauthenticatedSessions()
+			}
+		}
+	}()
+
+	log.Printf("✅ Session reaper started - timeout after %v without heartbeat", timeout)
+}
+
+func (h *WebSocketHandler) StopReaper() {
+	if h.reaperStop != nil {
+		close(h.reaperStop)
+		h.reaperStop = nil
+	}
+}
+
+func (h *WebSocketHandler) reapInactiveSessions(timeout time.Duration) {
+	for _, session := range h.sessionManager.CheckInactiveSessions(timeout) {
+		session.Send(WSMessage{
+			Type: "session_timeout",
+			Payload: fiber.Map{
+				"reason":         "heartbeat timeout",
+				"last_heartbeat": session.Info().LastHeartbeat.Unix(),
+			},
+		})
+		session.Close(CloseHeartbeatTimeout, "heartbeat timeout")
+	}
+}
+
+func (h *WebSocketHandler) reapUnauthenticatedSessions() {
+	if h.cfg.AuthTimeout <= 0 {
+		return
+	}
+	for _, session := range h.sessionManager.CheckAuthDeadline(h.cfg.AuthTimeout) {
+		log.Printf("⏰ Guest session %s did not authenticate within %v", session.ConnID, h.cfg.AuthTimeout)
+		session.Send(WSMessage{
+			Type:    "auth_timeout",
+			Payload: fiber.Map{"reason": "authentication deadline exceeded"},
+		})
+		session.Close(CloseAuthTimeout, "authentication timeout")
+	}
+}
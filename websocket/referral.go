@@ -0,0 +1,36 @@
+package websocket
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// HandleReferrals serves the caller's referral earnings; the token is passed
+// like for the WebSocket upgrade
+func (h *WebSocketHandler) HandleReferrals(c *fiber.Ctx) error {
+	token := requestToken(c)
+	if token == "" {
+		return fiber.NewError(fiber.StatusUnauthorized, "Authentication required")
+	}
+	identity, err := h.validateToken(token)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired token")
+	}
+	return h.ServeReferrals(c, identity.UserID)
+}
+
+// ServeReferrals writes the referral bonus totals of userID, per level and
+// per referred user
+func (h *WebSocketHandler) ServeReferrals(c *fiber.Ctx, userID primitive.ObjectID) error {
+	summary, err := h.db.ReferralSummary(userID)
+	if err != nil {
+		log.Printf("❌ Failed to summarise referrals of user %s: %v", userID.Hex(), err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to retrieve referral earnings")
+	}
+	return c.JSON(fiber.Map{
+		"summary":     summary,
+		"percentages": h.cfg.ReferralPercentages,
+	})
+}
@@ -0,0 +1,158 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"go-ubipay-websocket/auth"
+	"go-ubipay-websocket/database"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CloseAuthRevoked: the session's token is no longer valid
+const CloseAuthRevoked = 4004
+
+// StartRevalidator re-checks the token of every authenticated session every
+// cfg.AuthRevalidateInterval and, with cfg.AuthWatchUsers, whenever the
+// user's TblUser record changes
+func (h *WebSocketHandler) StartRevalidator() {
+	ctx, cancel := context.WithCancel(context.Background())
+	h.revalidateCancel = cancel
+
+	if h.cfg.AuthRevalidateInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(h.cfg.AuthRevalidateInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					h.revalidateSessions(nil)
+				}
+			}
+		}()
+		log.Printf("✅ Session revalidation started - every %v", h.cfg.AuthRevalidateInterval)
+	}
+
+	if h.cfg.AuthWatchUsers {
+		watcher, ok := h.db.(database.UserWatcher)
+		if !ok {
+			log.Printf("⚠️ AUTH_WATCH_USERS is set but the store does not support change streams")
+			return
+		}
+		go h.watchUsers(ctx, watcher)
+	}
+}
+
+func (h *WebSocketHandler) StopRevalidator() {
+	if h.revalidateCancel != nil {
+		h.revalidateCancel()
+		h.revalidateCancel = nil
+	}
+}
+
+// watchUsers keeps a TblUser change stream open, reopening it after
+// failures (or while the fallback store is still in memory)
+func (h *WebSocketHandler) watchUsers(ctx context.Context, watcher database.UserWatcher) {
+	retry := h.cfg.DBReconnectInterval
+	if retry <= 0 {
+		retry = 30 * time.Second
+	}
+
+	for {
+		log.Println("👀 Watching TblUser for session revocation")
+		err := watcher.WatchUsers(ctx, func(userID primitive.ObjectID) {
+			h.revalidateSessions(&userID)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err != database.ErrWatchUnsupported {
+			log.Printf("⚠️ TblUser change stream stopped: %v, retrying in %v", err, retry)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// revalidateSessions re-checks the tokens of all authenticated sessions, or
+// only those of userID, and disconnects the ones that were revoked. The
+// accrual rate of users that stay connected is refreshed, so tier changes
+// apply from the next accrual.
+func (h *WebSocketHandler) revalidateSessions(userID *primitive.ObjectID) {
+	type check struct {
+		userID primitive.ObjectID
+		token  string
+	}
+	reasons := make(map[check]string)
+	users := make(map[primitive.ObjectID]bool)
+
+	for _, ts := range h.sessionManager.GetTokenSessions(userID) {
+		key := check{ts.UserID, ts.Token}
+		reason, checked := reasons[key]
+		if !checked {
+			reason = h.revocationReason(ts.UserID, ts.Token)
+			reasons[key] = reason
+		}
+		if reason != "" {
+			h.revokeSession(ts.Session, reason)
+			continue
+		}
+		users[ts.UserID] = true
+	}
+
+	for id := range users {
+		h.RefreshTier(id)
+	}
+}
+
+// revocationReason returns why token no longer authenticates userID, or ""
+// if it still does. Lookup failures (e.g. MongoDB unreachable) keep the
+// session; it is checked again on the next pass.
+func (h *WebSocketHandler) revocationReason(userID primitive.ObjectID, token string) string {
+	identity, err := h.authenticator.Authenticate(token)
+	switch err {
+	case nil:
+	case auth.ErrTokenExpired:
+		return "token expired"
+	case auth.ErrUserDisabled:
+		return "user disabled"
+	case auth.ErrInvalidToken:
+		return "token revoked"
+	default:
+		log.Printf("⚠️ Could not revalidate session token for user %s: %v", userID.Hex(), err)
+		return ""
+	}
+
+	if identity.UserID != userID {
+		return "token belongs to another user"
+	}
+
+	// Signed JWTs stay valid until they expire; the account flag is
+	// checked separately
+	user, err := h.db.GetUserByID(userID)
+	if err == nil && !user.Enable {
+		return "user disabled"
+	}
+	return ""
+}
+
+func (h *WebSocketHandler) revokeSession(session *Session, reason string) {
+	info := session.Info()
+	log.Printf("🚫 Revoking session %s of user %s (%s): %s", session.ConnID, info.Username, info.UserID.Hex(), reason)
+	session.Send(WSMessage{
+		Type:    "auth_revoked",
+		Payload: fiber.Map{"reason": reason},
+	})
+	session.Close(CloseAuthRevoked, reason)
+}
@@ -1,89 +1,545 @@
 package websocket
 
 import (
+	"errors"
 	"log"
+	"math/big"
+	"sort"
 	"sync"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go-ubipay-websocket/accrual"
+	"go-ubipay-websocket/config"
+	"go-ubipay-websocket/points"
+
 	"github.com/gofiber/websocket/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Session is a single WebSocket connection. The identity and state fields
+// (UserID to Authenticated) change under the SessionManager lock and mu.
+// Only the connection's read loop, which is what re-keys it, may read them
+// directly; everything else goes through Info.
 type Session struct {
+	ConnID        string
 	UserID        primitive.ObjectID
 	Username      string
 	Conn          *websocket.Conn
 	ConnectedAt   time.Time
-	LastAccrualAt time.Time
 	LastHeartbeat time.Time
 	IsActive      bool
+	// TimedOut is set by the heartbeat reaper; accrual stops at LastHeartbeat
+	TimedOut bool
+	// Guest sessions are unauthenticated and do not accrue points
+	Guest bool
+	// Authenticated is set once the identity was verified with a token
+	Authenticated bool
+
+	mu   sync.RWMutex
+	user *UserSessions
+	// token the identity was verified with, kept for revalidation
+	token string
+
+	// Outbound queue drained by the connection's writer goroutine; see outbound.go
+	send        chan outboundMessage
+	sendMu      sync.Mutex
+	closed      bool
+	queuePolicy string
+	dropped     uint64
+}
+
+// SessionInfo is a consistent copy of a session's identity and state
+type SessionInfo struct {
+	ConnID        string
+	UserID        primitive.ObjectID
+	Username      string
+	ConnectedAt   time.Time
+	LastHeartbeat time.Time
+	IsActive      bool
+	TimedOut      bool
+	Guest         bool
+	Authenticated bool
+}
+
+// Info returns the session's current identity and state
+func (s *Session) Info() SessionInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return SessionInfo{
+		ConnID:        s.ConnID,
+		UserID:        s.UserID,
+		Username:      s.Username,
+		ConnectedAt:   s.ConnectedAt,
+		LastHeartbeat: s.LastHeartbeat,
+		IsActive:      s.IsActive,
+		TimedOut:      s.TimedOut,
+		Guest:         s.Guest,
+		Authenticated: s.Authenticated,
+	}
+}
+
+// UserSessions groups the open connections of one user. Accrual state lives
+// here so a user earns once regardless of how many connections are open.
+type UserSessions struct {
+	UserID        primitive.ObjectID
+	Username      string
+	LastAccrualAt time.Time
+	// AccrualCarry is the fractional point earned since LastAccrualAt that
+	// has not been credited yet, kept exact so no fraction is lost between
+	// windows. nil when there is none; never modified in place.
+	AccrualCarry *big.Rat
+	// Tier holds the rate multiplier and VIP level, looked up at auth time
+	// and refreshed before each accrual and on revalidation
+	Tier accrual.Tier
+	// LastHeartbeat of the most recently removed connection, used to settle
+	// a user whose last connection timed out
+	LastHeartbeat time.Time
+	TimedOut      bool
+	Guest         bool
+
+	conns map[string]*Session
+	// accrualMu is held while a window of the user is credited, so the cron
+	// and the final settlement never build the same idempotency key from one
+	// window start
+	accrualMu sync.Mutex
 }
 
+// UnlockAccrual releases the lock taken by LockAccrual
+func (u *UserSessions) UnlockAccrual() {
+	u.accrualMu.Unlock()
+}
+
+// Connection limit policies applied when a user exceeds MaxConnectionsPerUser
+const (
+	ConnPolicyKickOldest = "kick-oldest"
+	ConnPolicyRejectNew  = "reject-new"
+)
+
+var (
+	ErrTooManyConnections   = errors.New("too many connections for user")
+	ErrAlreadyAuthenticated = errors.New("session is already authenticated as another user")
+	ErrUserBanned           = errors.New("user is banned from connecting")
+)
+
 type SessionManager struct {
-	sessions map[primitive.ObjectID]*Session
-	mu       sync.RWMutex
+	cfg      *config.Config
+	sessions map[string]*Session
+	users    map[primitive.ObjectID]*UserSessions
+	// bans maps a user to the time it may reconnect again
+	bans map[primitive.ObjectID]time.Time
+	mu   sync.RWMutex
 }
 
-func NewSessionManager() *SessionManager {
+func NewSessionManager(cfg *config.Config) *SessionManager {
 	return &SessionManager{
-		sessions: make(map[primitive.ObjectID]*Session),
+		cfg:      cfg,
+		sessions: make(map[string]*Session),
+		users:    make(map[primitive.ObjectID]*UserSessions),
+		bans:     make(map[primitive.ObjectID]time.Time),
 	}
 }
 
-func (sm *SessionManager) AddSession(userID primitive.ObjectID, username string, conn *websocket.Conn) *Session {
+// AddSession registers a new connection for the user. If the user already
+// has MaxConnectionsPerUser connections, either the new one is rejected with
+// ErrTooManyConnections or the oldest ones are returned so the caller can
+// close them, depending on ConnectionPolicy. token is empty for guest and
+// dev-fixed-user connections.
+func (sm *SessionManager) AddSession(userID primitive.ObjectID, username string, guest bool, token string, conn *websocket.Conn) (*Session, []*Session, error) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
+	if _, banned := sm.bannedLocked(userID); banned {
+		return nil, nil, ErrUserBanned
+	}
+
+	user := sm.userLocked(userID, username, guest)
+	kicked, err := sm.makeRoomLocked(user)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	session := &Session{
+		ConnID:        primitive.NewObjectID().Hex(),
 		UserID:        userID,
 		Username:      username,
 		Conn:          conn,
 		ConnectedAt:   time.Now(),
-		LastAccrualAt: time.Now(),
 		LastHeartbeat: time.Now(),
 		IsActive:      true,
+		Guest:         guest,
+		Authenticated: token != "",
+		user:          user,
+		token:         token,
+		send:          make(chan outboundMessage, sm.cfg.SendQueueSize),
+		queuePolicy:   sm.cfg.SendQueuePolicy,
+	}
+
+	sm.sessions[session.ConnID] = session
+	user.conns[session.ConnID] = session
+	log.Printf("✅ Session %s created for user: %s (%s), %d open", session.ConnID, username, userID.Hex(), len(user.conns))
+	return session, kicked, nil
+}
+
+// userLocked returns the user's connection group, creating it if needed
+func (sm *SessionManager) userLocked(userID primitive.ObjectID, username string, guest bool) *UserSessions {
+	user, exists := sm.users[userID]
+	if !exists {
+		user = &UserSessions{
+			UserID:        userID,
+			Username:      username,
+			LastAccrualAt: time.Now(),
+			Tier:          accrual.Tier{Rate: points.One},
+			Guest:         guest,
+			conns:         make(map[string]*Session),
+		}
+		sm.users[userID] = user
+	}
+	return user
+}
+
+// makeRoomLocked applies the per-user connection limit before a connection
+// joins user
+func (sm *SessionManager) makeRoomLocked(user *UserSessions) ([]*Session, error) {
+	limit := sm.cfg.MaxConnectionsPerUser
+	if limit <= 0 || len(user.conns) < limit {
+		return nil, nil
+	}
+
+	if sm.cfg.ConnectionPolicy == ConnPolicyRejectNew {
+		log.Printf("⛔ Connection rejected for user %s (%s): %d connections open", user.Username, user.UserID.Hex(), len(user.conns))
+		if len(user.conns) == 0 {
+			delete(sm.users, user.UserID)
+		}
+		return nil, ErrTooManyConnections
+	}
+
+	// The user keeps its group (and accrual window): the new connection is
+	// about to join it
+	kicked := user.oldest(len(user.conns) - limit + 1)
+	for _, old := range kicked {
+		sm.evictLocked(old)
+	}
+	return kicked, nil
+}
+
+// AuthenticateSession moves a connection to the identity it authenticated
+// as with an in-band auth message. Only guest and dev-fixed-user connections
+// can change identity; an authenticated connection may only re-authenticate
+// as the same user. If the connection was the last one of its previous
+// (non-guest) identity, that identity is returned so the caller can settle
+// its accrual.
+func (sm *SessionManager) AuthenticateSession(connID string, userID primitive.ObjectID, username, token string) (*UserSessions, []*Session, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, exists := sm.sessions[connID]
+	if !exists {
+		return nil, nil, ErrSessionClosed
+	}
+
+	if session.UserID == userID {
+		session.mu.Lock()
+		session.Authenticated = true
+		session.token = token
+		session.mu.Unlock()
+		return nil, nil, nil
+	}
+	if session.Authenticated {
+		return nil, nil, ErrAlreadyAuthenticated
+	}
+	if _, banned := sm.bannedLocked(userID); banned {
+		return nil, nil, ErrUserBanned
 	}
 
-	sm.sessions[userID] = session
-	log.Printf("✅ Session created for user: %s (%s)", username, userID.Hex())
-	return session
+	user := sm.userLocked(userID, username, false)
+	kicked, err := sm.makeRoomLocked(user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	previous := session.user
+	delete(previous.conns, connID)
+
+	var settle *UserSessions
+	if len(previous.conns) == 0 {
+		delete(sm.users, previous.UserID)
+		if !previous.Guest {
+			settle = previous
+		}
+	}
+
+	log.Printf("🔀 Session %s re-keyed from %s (%s) to %s (%s)",
+		connID, session.Username, session.UserID.Hex(), username, userID.Hex())
+
+	session.mu.Lock()
+	session.UserID = userID
+	session.Username = username
+	session.Guest = false
+	session.Authenticated = true
+	session.token = token
+	session.mu.Unlock()
+	session.user = user
+	user.conns[connID] = session
+
+	return settle, kicked, nil
 }
 
-func (sm *SessionManager) GetSession(userID primitive.ObjectID) (*Session, bool) {
+// CheckAuthDeadline returns guest connections that have not authenticated
+// within timeout of connecting
+func (sm *SessionManager) CheckAuthDeadline(timeout time.Duration) []*Session {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	session, exists := sm.sessions[userID]
+	now := time.Now()
+	expired := make([]*Session, 0)
+	for _, session := range sm.sessions {
+		if session.Guest && session.IsActive && now.Sub(session.ConnectedAt) > timeout {
+			expired = append(expired, session)
+		}
+	}
+	return expired
+}
+
+// TokenSession is an authenticated connection and the token it was
+// verified with
+type TokenSession struct {
+	Session *Session
+	UserID  primitive.ObjectID
+	Token   string
+}
+
+// GetTokenSessions returns every token-authenticated connection, optionally
+// only those of one user
+func (sm *SessionManager) GetTokenSessions(userID *primitive.ObjectID) []TokenSession {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	sessions := make([]TokenSession, 0)
+	for _, session := range sm.sessions {
+		if session.token == "" || (userID != nil && session.UserID != *userID) {
+			continue
+		}
+		sessions = append(sessions, TokenSession{Session: session, UserID: session.UserID, Token: session.token})
+	}
+	return sessions
+}
+
+// oldest returns the n longest-connected sessions of the user
+func (u *UserSessions) oldest(n int) []*Session {
+	conns := make([]*Session, 0, len(u.conns))
+	for _, session := range u.conns {
+		conns = append(conns, session)
+	}
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].ConnectedAt.Before(conns[j].ConnectedAt)
+	})
+	if n > len(conns) {
+		n = len(conns)
+	}
+	return conns[:n]
+}
+
+func (sm *SessionManager) GetSession(connID string) (*Session, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, exists := sm.sessions[connID]
 	return session, exists
 }
 
-func (sm *SessionManager) RemoveSession(userID primitive.ObjectID) {
+// GetUserSessions returns every open connection of the user
+func (sm *SessionManager) GetUserSessions(userID primitive.ObjectID) []*Session {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	user, exists := sm.users[userID]
+	if !exists {
+		return nil
+	}
+	sessions := make([]*Session, 0, len(user.conns))
+	for _, session := range user.conns {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// RemoveSession deletes the connection. When it was the user's last one the
+// user's accrual state is returned so the caller can settle the final
+// window; otherwise the remaining connections keep accruing.
+func (sm *SessionManager) RemoveSession(connID string) (*Session, *UserSessions) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	if session, exists := sm.sessions[userID]; exists {
-		session.IsActive = false
-		delete(sm.sessions, userID)
-		log.Printf("🗑️ Session removed for user: %s (%s)", session.Username, userID.Hex())
+	session, exists := sm.sessions[connID]
+	if !exists {
+		return nil, nil
+	}
+	return session, sm.removeLocked(session)
+}
+
+// evictLocked detaches the connection from the manager and its user group
+// but leaves the group in place
+func (sm *SessionManager) evictLocked(session *Session) {
+	session.mu.Lock()
+	session.IsActive = false
+	session.mu.Unlock()
+	delete(sm.sessions, session.ConnID)
+	delete(session.user.conns, session.ConnID)
+	log.Printf("🗑️ Session %s removed for user: %s (%s)", session.ConnID, session.Username, session.UserID.Hex())
+}
+
+func (sm *SessionManager) removeLocked(session *Session) *UserSessions {
+	sm.evictLocked(session)
+
+	user := session.user
+	if len(user.conns) > 0 {
+		return nil
+	}
+
+	// A stale group must not take a newer one with it
+	if sm.users[user.UserID] == user {
+		delete(sm.users, user.UserID)
+	}
+	user.LastHeartbeat = session.LastHeartbeat
+	user.TimedOut = session.TimedOut
+	return user
+}
+
+// RemoveUser deletes every connection of the user and returns them, with
+// the user's accrual state, so the caller can close and settle them
+func (sm *SessionManager) RemoveUser(userID primitive.ObjectID) ([]*Session, *UserSessions) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	user, exists := sm.users[userID]
+	if !exists {
+		return nil, nil
+	}
+	sessions := make([]*Session, 0, len(user.conns))
+	for _, session := range user.conns {
+		sessions = append(sessions, session)
+		sm.removeLocked(session)
 	}
+	return sessions, user
 }
 
-func (sm *SessionManager) UpdateHeartbeat(userID primitive.ObjectID) {
+// Ban rejects new connections and in-band authentication of the user until
+// the given time
+func (sm *SessionManager) Ban(userID primitive.ObjectID, until time.Time) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	if session, exists := sm.sessions[userID]; exists {
+	sm.bans[userID] = until
+	log.Printf("🚷 User %s banned until %s", userID.Hex(), until.Format(time.RFC3339))
+}
+
+// Unban lifts a ban; it reports whether the user was banned
+func (sm *SessionManager) Unban(userID primitive.ObjectID) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	_, banned := sm.bannedLocked(userID)
+	delete(sm.bans, userID)
+	return banned
+}
+
+// BannedUntil reports whether the user is banned and until when
+func (sm *SessionManager) BannedUntil(userID primitive.ObjectID) (time.Time, bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.bannedLocked(userID)
+}
+
+// bannedLocked checks the ban list and drops expired entries; sm.mu must be
+// held for writing
+func (sm *SessionManager) bannedLocked(userID primitive.ObjectID) (time.Time, bool) {
+	until, exists := sm.bans[userID]
+	if !exists {
+		return time.Time{}, false
+	}
+	if time.Now().After(until) {
+		delete(sm.bans, userID)
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+func (sm *SessionManager) UpdateHeartbeat(connID string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if session, exists := sm.sessions[connID]; exists {
+		session.mu.Lock()
 		session.LastHeartbeat = time.Now()
+		session.mu.Unlock()
 	}
 }
 
-func (sm *SessionManager) UpdateLastAccrual(userID primitive.ObjectID) {
+// AccrualState returns the start of the user's current accrual window, the
+// fractional carry from the previous one and the tier
+func (sm *SessionManager) AccrualState(userID primitive.ObjectID) (time.Time, *big.Rat, accrual.Tier, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	user, exists := sm.users[userID]
+	if !exists {
+		return time.Time{}, nil, accrual.Tier{}, false
+	}
+	return user.LastAccrualAt, user.AccrualCarry, user.Tier, true
+}
+
+// AccrualStateOf is AccrualState for a group that may already be removed
+func (sm *SessionManager) AccrualStateOf(user *UserSessions) (time.Time, *big.Rat, accrual.Tier) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return user.LastAccrualAt, user.AccrualCarry, user.Tier
+}
+
+// LockAccrual takes the accrual lock of the user's current group and
+// returns it, or nil when the user has no group (any more). A group removed
+// while waiting has been settled by whoever removed it.
+func (sm *SessionManager) LockAccrual(userID primitive.ObjectID) *UserSessions {
+	sm.mu.RLock()
+	user := sm.users[userID]
+	sm.mu.RUnlock()
+	if user == nil {
+		return nil
+	}
+
+	user.accrualMu.Lock()
+	sm.mu.RLock()
+	current := sm.users[userID] == user
+	sm.mu.RUnlock()
+	if !current {
+		user.accrualMu.Unlock()
+		return nil
+	}
+	return user
+}
+
+// SetTier caches the user's tier and returns the previous one
+func (sm *SessionManager) SetTier(userID primitive.ObjectID, tier accrual.Tier) (accrual.Tier, bool) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	if session, exists := sm.sessions[userID]; exists {
-		session.LastAccrualAt = time.Now()
+	user, exists := sm.users[userID]
+	if !exists {
+		return accrual.Tier{}, false
 	}
+	previous := user.Tier
+	user.Tier = tier
+	return previous, true
+}
+
+// UpdateLastAccrual closes the group's accrual window at the given time. It
+// writes to the group even once it is removed, so a settlement waiting on
+// the accrual lock starts where this window ended.
+func (sm *SessionManager) UpdateLastAccrual(user *UserSessions, at time.Time, carry *big.Rat) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	user.LastAccrualAt = at
+	user.AccrualCarry = carry
 }
 
 func (sm *SessionManager) GetAllSessions() []*Session {
@@ -110,21 +566,80 @@ func (sm *SessionManager) GetActiveSessions() []*Session {
 	return activeSessions
 }
 
-func (sm *SessionManager) CheckInactiveSessions(timeout time.Duration) []primitive.ObjectID {
+// ActiveUser identifies a user with at least one active connection
+type ActiveUser struct {
+	UserID   primitive.ObjectID
+	Username string
+}
+
+// GetActiveUsers returns each authenticated user with an active connection
+// once, no matter how many connections they have open
+func (sm *SessionManager) GetActiveUsers() []ActiveUser {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	activeUsers := make([]ActiveUser, 0, len(sm.users))
+	for _, user := range sm.users {
+		if user.Guest {
+			continue
+		}
+		for _, session := range user.conns {
+			if session.IsActive {
+				activeUsers = append(activeUsers, ActiveUser{UserID: user.UserID, Username: user.Username})
+				break
+			}
+		}
+	}
+	return activeUsers
+}
+
+// CountUserConnections returns the number of open connections of the user
+func (sm *SessionManager) CountUserConnections(userID primitive.ObjectID) int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	if user, exists := sm.users[userID]; exists {
+		return len(user.conns)
+	}
+	return 0
+}
+
+// CheckInactiveSessions marks connections without a heartbeat for longer
+// than timeout as inactive and returns them
+func (sm *SessionManager) CheckInactiveSessions(timeout time.Duration) []*Session {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	now := time.Now()
-	inactiveUsers := make([]primitive.ObjectID, 0)
+	inactiveSessions := make([]*Session, 0)
 
-	for userID, session := range sm.sessions {
+	for _, session := range sm.sessions {
 		if session.IsActive && now.Sub(session.LastHeartbeat) > timeout {
+			session.mu.Lock()
 			session.IsActive = false
-			inactiveUsers = append(inactiveUsers, userID)
-			log.Printf("⚠️ Session marked inactive due to heartbeat timeout: %s (%s)", 
-				session.Username, userID.Hex())
+			session.TimedOut = true
+			session.mu.Unlock()
+			inactiveSessions = append(inactiveSessions, session)
+			log.Printf("⚠️ Session %s marked inactive due to heartbeat timeout: %s (%s)",
+				session.ConnID, session.Username, session.UserID.Hex())
 		}
 	}
 
-	return inactiveUsers
-}
\ No newline at end of file
+	return inactiveSessions
+}
+
+// QueueStats summarises the outbound queues of all sessions
+func (sm *SessionManager) QueueStats() (totalDepth, maxDepth int, dropped uint64) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	for _, session := range sm.sessions {
+		depth := session.QueueDepth()
+		totalDepth += depth
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		dropped += session.DroppedMessages()
+	}
+	return totalDepth, maxDepth, dropped
+}
@@ -0,0 +1,146 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"go-ubipay-websocket/config"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTestSessionManager(limit int, policy string) *SessionManager {
+	return NewSessionManager(&config.Config{
+		MaxConnectionsPerUser: limit,
+		ConnectionPolicy:      policy,
+		SendQueueSize:         8,
+	})
+}
+
+func TestKickOldestWithLimitOne(t *testing.T) {
+	sm := newTestSessionManager(1, ConnPolicyKickOldest)
+	userID := primitive.NewObjectID()
+
+	first, _, err := sm.AddSession(userID, "alice", false, "t1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, _, _, _ := sm.AccrualState(userID)
+
+	second, kicked, err := sm.AddSession(userID, "alice", false, "t2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kicked) != 1 || kicked[0] != first {
+		t.Fatalf("kicked = %v, want the first connection", kicked)
+	}
+
+	if users := sm.GetActiveUsers(); len(users) != 1 || users[0].UserID != userID {
+		t.Fatalf("active users = %v, want alice", users)
+	}
+	if sessions := sm.GetUserSessions(userID); len(sessions) != 1 || sessions[0] != second {
+		t.Fatalf("user sessions = %v, want the second connection", sessions)
+	}
+	at, _, _, exists := sm.AccrualState(userID)
+	if !exists || !at.Equal(from) {
+		t.Fatalf("accrual window = %v (exists %v), want it kept from %v", at, exists, from)
+	}
+
+	// Closing the kicked connection must not settle or drop the user
+	if _, user := sm.RemoveSession(first.ConnID); user != nil {
+		t.Fatal("kicked connection returned settlement state")
+	}
+	if sessions := sm.GetUserSessions(userID); len(sessions) != 1 {
+		t.Fatalf("user sessions after closing the kicked one = %d, want 1", len(sessions))
+	}
+
+	// Closing the last connection settles
+	if _, user := sm.RemoveSession(second.ConnID); user == nil {
+		t.Fatal("last connection did not return settlement state")
+	}
+	if _, _, _, exists := sm.AccrualState(userID); exists {
+		t.Fatal("user still tracked after its last connection closed")
+	}
+}
+
+func TestAuthenticateSessionWithLimitOne(t *testing.T) {
+	sm := newTestSessionManager(1, ConnPolicyKickOldest)
+	userID := primitive.NewObjectID()
+
+	existing, _, err := sm.AddSession(userID, "alice", false, "t1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guest, _, err := sm.AddSession(primitive.NewObjectID(), "guest", true, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settle, kicked, err := sm.AuthenticateSession(guest.ConnID, userID, "alice", "t2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settle != nil {
+		t.Fatal("guest identity returned settlement state")
+	}
+	if len(kicked) != 1 || kicked[0] != existing {
+		t.Fatalf("kicked = %v, want the existing connection", kicked)
+	}
+	if sessions := sm.GetUserSessions(userID); len(sessions) != 1 || sessions[0] != guest {
+		t.Fatalf("user sessions = %v, want the re-keyed connection", sessions)
+	}
+}
+
+func TestRejectNewWithLimitOne(t *testing.T) {
+	sm := newTestSessionManager(1, ConnPolicyRejectNew)
+	userID := primitive.NewObjectID()
+
+	if _, _, err := sm.AddSession(userID, "alice", false, "t1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := sm.AddSession(userID, "alice", false, "t2", nil); err != ErrTooManyConnections {
+		t.Fatalf("err = %v, want ErrTooManyConnections", err)
+	}
+	if n := sm.CountUserConnections(userID); n != 1 {
+		t.Fatalf("connections = %d, want 1", n)
+	}
+}
+
+func TestAccrualLockHandsWindowToSettlement(t *testing.T) {
+	sm := newTestSessionManager(0, ConnPolicyKickOldest)
+	userID := primitive.NewObjectID()
+
+	session, _, err := sm.AddSession(userID, "alice", false, "t1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cron locks the user, then the last connection closes mid-credit
+	group := sm.LockAccrual(userID)
+	if group == nil {
+		t.Fatal("no group to lock")
+	}
+	_, settle := sm.RemoveSession(session.ConnID)
+	if settle != group {
+		t.Fatal("last connection did not return the locked group")
+	}
+
+	settled := make(chan time.Time)
+	go func() {
+		settle.accrualMu.Lock()
+		defer settle.accrualMu.Unlock()
+		from, _, _ := sm.AccrualStateOf(settle)
+		settled <- from
+	}()
+
+	closedAt := time.Now().Add(time.Minute)
+	sm.UpdateLastAccrual(group, closedAt, nil)
+	group.UnlockAccrual()
+
+	if from := <-settled; !from.Equal(closedAt) {
+		t.Fatalf("settlement starts at %v, want the window the cron closed at %v", from, closedAt)
+	}
+	if sm.LockAccrual(userID) != nil {
+		t.Fatal("locked the accrual of a removed user")
+	}
+}